@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/velvetriddles/mortgage-calc/internal/config"
+	"github.com/velvetriddles/mortgage-calc/internal/features"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// runConfig checks the configuration the server would start with, for CI pipelines:
+//
+//	mortgage-calc config check [-config config.yml] [flags]
+//
+// The environment and the flags override the file as they do for the server.
+// It returns the process exit code.
+func runConfig(args []string, out io.Writer) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: mortgage-calc config check [-config config.yml] [flags]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	configPath := flags.String("config", "config.yml", "path to the configuration file")
+	config.RegisterFlags(flags)
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if _, err := checkConfig(*configPath, flags); err != nil {
+		// Prefix every problem with the file name as compilers do
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *configPath, line)
+		}
+		return 1
+	}
+
+	fmt.Fprintf(out, "%s: OK\n", *configPath)
+
+	return 0
+}
+
+// checkConfig loads the configuration and checks the program catalogs and
+// the feature flags it describes
+func checkConfig(path string, flags *flag.FlagSet) (*config.Config, error) {
+	cfg, err := config.LoadConfig(path, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = features.Validate(featuresFromConfig(cfg.Features)); err != nil {
+		return nil, fmt.Errorf("features: %w", err)
+	}
+
+	programs, err := catalogFromConfig(cfg.Programs, cfg.Limits)
+	if err == nil {
+		err = service.NewMortCalculator().SetPrograms(programs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("programs: %w", err)
+	}
+
+	if _, err = tenantCatalogs(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
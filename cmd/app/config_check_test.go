@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRunConfig checks the exit codes of config check and that catalog problems
+// found by the calculator are reported as well as those of the file
+func TestRunConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected int
+	}{
+		{name: "valid", file: "port: 8080\n", expected: 0},
+		{name: "invalid file", file: "port: 0\n", expected: 1},
+		{name: "invalid catalog", file: "programs:\n  - code: promo\n    name: Promo\n    rate: 0.3\n" +
+			"    min_initial_payment: 20\n    modifiers: [salary_client]\n", expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			var out bytes.Buffer
+			if code := runConfig([]string{"check", "-config", path}, &out); code != tt.expected {
+				t.Errorf("Expected exit code %d, got %d", tt.expected, code)
+			}
+			if ok := strings.HasSuffix(out.String(), ": OK\n"); ok != (tt.expected == 0) {
+				t.Errorf("Expected OK to be printed for valid files only, got %q", out.String())
+			}
+		})
+	}
+}
@@ -1,38 +1,241 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"time"
+	_ "time/tzdata" // the scratch image has no zoneinfo
+
+	"github.com/shopspring/decimal"
 
 	"github.com/velvetriddles/mortgage-calc/internal/cache"
 	"github.com/velvetriddles/mortgage-calc/internal/config"
+	"github.com/velvetriddles/mortgage-calc/internal/features"
 	"github.com/velvetriddles/mortgage-calc/internal/handler"
+	"github.com/velvetriddles/mortgage-calc/internal/logging"
 	"github.com/velvetriddles/mortgage-calc/internal/middleware"
 	"github.com/velvetriddles/mortgage-calc/internal/service"
+	"github.com/velvetriddles/mortgage-calc/internal/storage"
+	"github.com/velvetriddles/mortgage-calc/internal/tenant"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "scenario" {
+		os.Exit(runScenario(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:], os.Stdout))
+	}
+
+	flags := flag.NewFlagSet("mortgage-calc", flag.ExitOnError)
+	configPath := flags.String("config", "config.yml", "path to the configuration file, watched for changes while serving")
+	printConfig := flags.Bool("print-config", false, "print the effective configuration and exit")
+	allowInvalid := flags.Bool("allow-invalid-config", false, "start with the defaults when the configuration is invalid rather than exit")
+	config.RegisterFlags(flags)
+	_ = flags.Parse(os.Args[1:])
+
+	if *printConfig {
+		os.Exit(runPrintConfig(*configPath, flags, os.Stdout))
+	}
+
 	log.Println("Starting mortgage calculator...")
 
-	cfg, err := config.LoadConfig("config.yml")
+	cfg, err := checkConfig(*configPath, flags)
 	if err != nil {
-		log.Printf("Error loading configuration: %v, using default values", err)
-		cfg = config.New()
+		if !*allowInvalid {
+			log.Fatalf("Invalid configuration, fix it or start with --allow-invalid-config:\n%v", err)
+		}
+		log.Printf("Invalid configuration, starting anyway as --allow-invalid-config is set:\n%v", err)
+		cfg = loadConfig(*configPath, flags)
+	}
+
+	location, err := cfg.Location()
+	if err != nil {
+		log.Printf("Error loading timezone: %v, using UTC", err)
+		location = time.UTC
 	}
 
 	mortCache := cache.NewMortCache()
-	mux := http.NewServeMux()
+	mortCache.SetMaxItems(cfg.Cache.MaxItems)
+	calculator := newCalculator(cfg)
+
+	var admin http.Handler
+	if cfg.AdminToken != "" {
+		admin = handler.NewAdminHandler(calculator, cfg.AdminToken)
+	} else {
+		log.Println("Admin API disabled: no admin token configured")
+	}
+
+	router, _ := tenant.NewRouter(http.NotFoundHandler(), nil)
+	sites := &sites{router: router, location: location, admin: admin, main: &site{calculator: calculator, cache: mortCache}}
+	catalogs, err := tenantCatalogs(cfg)
+	if err == nil {
+		err = sites.set(cfg, catalogs)
+	}
+	if err != nil {
+		log.Printf("Error loading tenants: %v, serving our own site only", err)
+		withoutTenants := *cfg
+		withoutTenants.Tenants = nil
+		_ = sites.set(&withoutTenants, nil)
+	}
+
+	requestLogger, err := middleware.NewRequestLogger(cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		log.Printf("Error in log settings: %v, logging every request as text", err)
+		requestLogger, _ = middleware.NewRequestLogger(logging.LevelInfo, logging.FormatText)
+	}
+
+	featureFlags, err := features.NewFlags(featuresFromConfig(cfg.Features))
+	if err != nil {
+		log.Printf("Error in feature flags: %v, all features disabled", err)
+		featureFlags, _ = features.NewFlags(nil)
+	}
+
+	reloader := &reloader{current: cfg, calculator: calculator, sites: sites, logger: requestLogger, features: featureFlags}
+	config.Watch(*configPath, flags, reloader.reload)
+
+	server := &http.Server{
+		Addr:         cfg.ListenAddress(),
+		Handler:      requestLogger.Handler(featureFlags.Handler(router)),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+	log.Printf("Server started on %s", server.Addr)
+	log.Fatal(server.ListenAndServe())
+}
+
+// loadConfig reads the configuration, without the file when it cannot be read
+// and with the defaults when the rest is invalid too
+func loadConfig(path string, flags *flag.FlagSet) *config.Config {
+	cfg, err := config.LoadConfig(path, flags)
+	if err == nil {
+		return cfg
+	}
+
+	log.Printf("Error loading configuration: %v, ignoring the file", err)
+	if cfg, err = config.LoadConfig("", flags); err != nil {
+		log.Printf("Error loading configuration: %v, using default values", err)
+		return config.New()
+	}
+
+	return cfg
+}
 
+// runPrintConfig prints the effective configuration, it returns the process exit code
+func runPrintConfig(path string, flags *flag.FlagSet, out io.Writer) int {
+	cfg, err := config.LoadConfig(path, flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err = cfg.Print(out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+// newCalculator creates the calculator with the configured programs, contributions and limits
+func newCalculator(cfg *config.Config) *service.MortCalculator {
 	calculator := service.NewMortCalculator()
-	mortHandler := handler.NewMortHandler(mortCache, calculator)
+	if len(cfg.Programs) > 0 || len(cfg.Limits) > 0 {
+		programs, err := catalogFromConfig(cfg.Programs, cfg.Limits)
+		if err == nil {
+			err = calculator.SetPrograms(programs)
+		}
+		if err != nil {
+			log.Printf("Error loading program catalog: %v, using built-in programs", err)
+		}
+	}
+	if contributions := militaryContributions(cfg); contributions != nil {
+		calculator.SetMilitaryContributions(contributions)
+	}
+	if cfg.ProgramsFile != "" {
+		if err := calculator.UseStore(storage.NewCatalogFile(cfg.ProgramsFile)); err != nil {
+			log.Printf("Error loading saved program catalog: %v, catalog changes are not saved", err)
+		}
+	}
+
+	return calculator
+}
 
-	mux.HandleFunc("/execute", mortHandler.Execute)
-	mux.HandleFunc("/cache", mortHandler.GetCache)
+// catalogFromConfig returns the programs, or the built-in ones when none are
+// configured, with the limit overrides applied
+func catalogFromConfig(cfgs []config.ProgramConfig, limits map[string]config.LimitsConfig) ([]service.Program, error) {
+	programs := service.DefaultPrograms
+	if len(cfgs) > 0 {
+		var err error
+		if programs, err = programsFromConfig(cfgs); err != nil {
+			return nil, err
+		}
+	}
+
+	return withLimits(programs, limits)
+}
 
-	loggerMiddleware := middleware.Logger(mux)
+// withLimits returns a copy of the programs with the limits of the listed programs replaced
+func withLimits(programs []service.Program, limits map[string]config.LimitsConfig) ([]service.Program, error) {
+	programs = append([]service.Program(nil), programs...)
+	for code, cfg := range limits {
+		found := false
+		for i := range programs {
+			if programs[i].Code == code {
+				programs[i].Limits = limitsFromConfig(cfg)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("limits: %w: %s", service.ErrUnknownProgram, code)
+		}
+	}
+
+	return programs, nil
+}
+
+// militaryContributions returns the configured contributions, nil to keep the built-in table
+func militaryContributions(cfg *config.Config) map[int]decimal.Decimal {
+	if len(cfg.MilitaryContributions) == 0 {
+		return nil
+	}
+
+	contributions := make(map[int]decimal.Decimal, len(cfg.MilitaryContributions))
+	for year, amount := range cfg.MilitaryContributions {
+		contributions[year] = decimal.NewFromFloat(amount)
+	}
+
+	return contributions
+}
+
+func featuresFromConfig(cfgs []config.FeatureConfig) []features.Flag {
+	flags := make([]features.Flag, len(cfgs))
+	for i, cfg := range cfgs {
+		flags[i] = features.Flag{Name: cfg.Name, Percentage: cfg.Percentage, Clients: cfg.Clients}
+	}
+
+	return flags
+}
+
+func limitsFromConfig(cfg config.LimitsConfig) service.Limits {
+	limits := service.Limits{
+		MinLoan:   decimal.NewFromFloat(cfg.MinLoan),
+		MaxLoan:   decimal.NewFromFloat(cfg.MaxLoan),
+		MinMonths: cfg.MinMonths,
+		MaxMonths: cfg.MaxMonths,
+	}
+
+	if len(cfg.Regions) > 0 {
+		limits.RegionMaxLoan = make(map[string]decimal.Decimal, len(cfg.Regions))
+		for region, maxLoan := range cfg.Regions {
+			limits.RegionMaxLoan[region] = decimal.NewFromFloat(maxLoan)
+		}
+	}
 
-	serverAddr := fmt.Sprintf(":%d", cfg.Port)
-	log.Printf("Server started on port %d", cfg.Port)
-	log.Fatal(http.ListenAndServe(serverAddr, loggerMiddleware))
+	return limits
 }
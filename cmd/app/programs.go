@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/config"
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// programsFromConfig converts the configured catalog to programs, resolving
+// modifier codes and eligibility rule names
+func programsFromConfig(cfgs []config.ProgramConfig) ([]service.Program, error) {
+	programs := make([]service.Program, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		limits := limitsFromConfig(cfg.Limits)
+		definition := model.ProgramDefinition{
+			Code:        cfg.Code,
+			Name:        cfg.Name,
+			Lender:      cfg.Lender,
+			IssueFee:    decimal.NewFromFloat(cfg.IssueFee),
+			Feature:     cfg.Feature,
+			Active:      true,
+			Tiers:       tiersFromConfig(cfg.MinInitialPayment, cfg.Rate, cfg.Tiers),
+			Modifiers:   cfg.Modifiers,
+			Eligibility: cfg.Eligibility,
+			Limits: model.ProgramLimits{
+				MinLoan:   limits.MinLoan,
+				MaxLoan:   limits.MaxLoan,
+				MinMonths: limits.MinMonths,
+				MaxMonths: limits.MaxMonths,
+				Regions:   limits.RegionMaxLoan,
+			},
+		}
+
+		for _, rule := range cfg.Rules {
+			definition.Rules = append(definition.Rules, model.EligibilityRuleDefinition{
+				Name:       rule.Name,
+				Condition:  rule.Condition,
+				Expression: rule.Expression,
+			})
+		}
+
+		for _, period := range cfg.Rates {
+			definition.Rates = append(definition.Rates, model.RatePeriod{
+				EffectiveFrom: model.NewDate(period.EffectiveFrom),
+				Tiers:         tiersFromConfig(period.MinInitialPayment, period.Rate, period.Tiers),
+			})
+		}
+
+		program, err := service.ProgramFromDefinition(definition)
+		if err != nil {
+			return nil, err
+		}
+		programs = append(programs, program)
+	}
+
+	return programs, nil
+}
+
+// tiersFromConfig builds the first tier from the minimum initial payment and rate
+// followed by the additional tiers
+func tiersFromConfig(minInitialPayment, rate float64, cfgs []config.TierConfig) []model.RateTier {
+	tiers := []model.RateTier{{
+		MinInitialPayment: decimal.NewFromFloat(minInitialPayment),
+		Rate:              decimal.NewFromFloat(rate),
+	}}
+	for _, tier := range cfgs {
+		tiers = append(tiers, model.RateTier{
+			MinInitialPayment: decimal.NewFromFloat(tier.MinInitialPayment),
+			Rate:              decimal.NewFromFloat(tier.Rate),
+		})
+	}
+
+	return tiers
+}
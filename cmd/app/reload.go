@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/velvetriddles/mortgage-calc/internal/config"
+	"github.com/velvetriddles/mortgage-calc/internal/features"
+	"github.com/velvetriddles/mortgage-calc/internal/logging"
+	"github.com/velvetriddles/mortgage-calc/internal/middleware"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// reloadable are the settings applied to the running server,
+// the others take effect after a restart
+var reloadable = []string{"programs", "limits", "log", "features", "branding", "tenants"}
+
+// reloader applies changes of the configuration file to the running server
+type reloader struct {
+	mu         sync.Mutex
+	current    *config.Config
+	calculator *service.MortCalculator
+	sites      *sites
+	logger     *middleware.RequestLogger
+	features   *features.Flags
+}
+
+// reload validates the new configuration as a whole and applies it, an invalid
+// file is rejected and the previous configuration stays in effect
+func (r *reloader) reload(cfg *config.Config, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Configuration reload rejected: %v, keeping the previous configuration", err)
+		return
+	}
+
+	changes := config.Diff(r.current, cfg)
+	if len(changes) == 0 {
+		return
+	}
+
+	flags := featuresFromConfig(cfg.Features)
+	err = features.Validate(flags)
+	if err == nil {
+		_, err = logging.ParseLevel(cfg.Log.Level)
+	}
+	if err == nil {
+		_, err = logging.ParseFormat(cfg.Log.Format)
+	}
+	if err != nil {
+		log.Printf("Configuration reload rejected: %v, keeping the previous configuration", err)
+		return
+	}
+
+	// The tenants are checked before anything is applied, so that a broken
+	// tenant does not leave the catalogs half reloaded
+	catalogsChanged := !reflect.DeepEqual(r.current.Programs, cfg.Programs) || !reflect.DeepEqual(r.current.Limits, cfg.Limits)
+	sitesChanged := catalogsChanged || !reflect.DeepEqual(r.current.Tenants, cfg.Tenants) || !reflect.DeepEqual(r.current.Branding, cfg.Branding)
+	var catalogs [][]service.Program
+	if sitesChanged {
+		if catalogs, err = tenantCatalogs(cfg); err != nil {
+			log.Printf("Configuration reload rejected: %v, keeping the previous configuration", err)
+			return
+		}
+	}
+
+	// A catalog saved through the admin API takes precedence over the configured
+	// programs, as it does on start, and is not overwritten by them
+	saved := false
+	if catalogsChanged {
+		if saved, err = r.calculator.HasSavedCatalog(); err != nil {
+			log.Printf("Configuration reload rejected: %v, keeping the previous configuration", err)
+			return
+		}
+	}
+	if saved {
+		log.Printf("Configured programs and limits ignored: the catalog saved in %s takes precedence", cfg.ProgramsFile)
+	}
+
+	// The catalog is swapped as one new version, so no calculation sees it half changed
+	if catalogsChanged && !saved {
+		programs, err := catalogFromConfig(cfg.Programs, cfg.Limits)
+		if err == nil {
+			err = r.calculator.SetPrograms(programs)
+		}
+		if err != nil {
+			log.Printf("Configuration reload rejected: %v, keeping the previous configuration", err)
+			return
+		}
+	}
+	if sitesChanged {
+		if err = r.sites.set(cfg, catalogs); err != nil {
+			log.Printf("Error reloading tenants: %v", err)
+		}
+	}
+
+	// The flags and the log settings were checked above, an error here leaves
+	// the configuration unrecorded so that the next reload applies it again
+	err = r.features.Set(flags)
+	if err == nil {
+		err = r.logger.SetLevel(cfg.Log.Level)
+	}
+	if err == nil {
+		err = r.logger.SetFormat(cfg.Log.Format)
+	}
+	if err != nil {
+		log.Printf("Error reloading the configuration: %v", err)
+		return
+	}
+
+	for _, change := range changes {
+		if isReloadable(change) {
+			log.Printf("Configuration changed: %s", change)
+		} else {
+			log.Printf("Configuration changed: %s, takes effect after a restart", change)
+		}
+	}
+	log.Printf("Configuration reloaded, program catalog version %d", r.calculator.Catalog().Version)
+
+	r.current = cfg
+}
+
+func isReloadable(change string) bool {
+	for _, prefix := range reloadable {
+		if strings.HasPrefix(change, prefix+".") || strings.HasPrefix(change, prefix+":") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/cache"
+	"github.com/velvetriddles/mortgage-calc/internal/config"
+	"github.com/velvetriddles/mortgage-calc/internal/features"
+	"github.com/velvetriddles/mortgage-calc/internal/middleware"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+	"github.com/velvetriddles/mortgage-calc/internal/tenant"
+)
+
+// newTestReloader wires the configuration as main does
+func newTestReloader(t *testing.T, cfg *config.Config) *reloader {
+	t.Helper()
+
+	calculator := newCalculator(cfg)
+	router, _ := tenant.NewRouter(http.NotFoundHandler(), nil)
+	sites := &sites{router: router, location: time.UTC, main: &site{calculator: calculator, cache: cache.NewMortCache()}}
+	catalogs, err := tenantCatalogs(cfg)
+	if err == nil {
+		err = sites.set(cfg, catalogs)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	logger, err := middleware.NewRequestLogger(cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	flags, err := features.NewFlags(featuresFromConfig(cfg.Features))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return &reloader{current: cfg, calculator: calculator, sites: sites, logger: logger, features: flags}
+}
+
+// withProgram returns a copy of the configuration with a single configured program
+func withProgram(cfg *config.Config, rate float64) *config.Config {
+	changed := *cfg
+	changed.Programs = []config.ProgramConfig{{Code: "base", Name: "Base", Rate: rate, MinInitialPayment: 20}}
+
+	return &changed
+}
+
+// TestReload_SavedCatalog checks that the configured programs are reloaded
+// unless a catalog saved through the admin API takes precedence
+func TestReload_SavedCatalog(t *testing.T) {
+	cfg := config.New()
+	cfg.ProgramsFile = filepath.Join(t.TempDir(), "catalog.json")
+	r := newTestReloader(t, cfg)
+
+	// Without a saved catalog the configured programs apply and are not saved
+	r.reload(withProgram(cfg, 9), nil)
+	catalog := r.calculator.Catalog()
+	if catalog.Version != 2 || len(catalog.Programs) != 1 || !catalog.Programs[0].Tiers[0].Rate.Equal(decimal.NewFromInt(9)) {
+		t.Fatalf("Expected the configured program in version 2, got %+v", catalog)
+	}
+	if _, err := os.Stat(cfg.ProgramsFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the configured catalog not to be saved, got %v", err)
+	}
+
+	// A program created through the admin API is saved and survives the reload
+	definition := service.BaseProgram.Definition()
+	definition.Code = "promo"
+	definition.Name = "Promo"
+	if _, err := r.calculator.CreateProgram(definition); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	saved, err := os.ReadFile(cfg.ProgramsFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r.reload(withProgram(cfg, 10), nil)
+	catalog = r.calculator.Catalog()
+	if catalog.Version != 3 || len(catalog.Programs) != 2 || catalog.Programs[1].Code != "promo" {
+		t.Errorf("Expected the saved catalog to stay in version 3, got %+v", catalog)
+	}
+	if after, _ := os.ReadFile(cfg.ProgramsFile); string(after) != string(saved) {
+		t.Errorf("Expected the saved catalog file to be left unchanged")
+	}
+}
+
+// TestReload checks that a valid configuration is applied as a whole and an
+// invalid one leaves the previous configuration in effect
+func TestReload(t *testing.T) {
+	cfg := config.New()
+	r := newTestReloader(t, cfg)
+
+	// An invalid file is rejected
+	r.reload(nil, config.Errors{{Key: "port", Message: "must be from 1 to 65535, got 0"}})
+	if r.current != cfg || r.calculator.Catalog().Version != 1 {
+		t.Errorf("Expected the previous configuration to stay after an invalid file")
+	}
+
+	// A catalog that fails the calculator checks is rejected too
+	invalid := withProgram(cfg, 9)
+	invalid.Programs[0].Modifiers = []string{"unknown"}
+	r.reload(invalid, nil)
+	if r.current != cfg || r.calculator.Catalog().Version != 1 {
+		t.Errorf("Expected the previous configuration to stay after an invalid catalog")
+	}
+
+	// So is an unknown log level or format, before the programs are applied
+	for _, log := range []config.LogConfig{{Level: "debug", Format: "text"}, {Level: "info", Format: "xml"}} {
+		invalid = withProgram(cfg, 9)
+		invalid.Log = log
+		r.reload(invalid, nil)
+		if r.current != cfg || r.calculator.Catalog().Version != 1 {
+			t.Errorf("Expected the previous configuration to stay after log settings %+v", log)
+		}
+	}
+
+	// Changed programs are published as a new catalog version
+	changed := withProgram(cfg, 9)
+	r.reload(changed, nil)
+	if r.current != changed || r.calculator.Catalog().Version != 2 {
+		t.Fatalf("Expected the programs in catalog version 2, got version %d", r.calculator.Catalog().Version)
+	}
+
+	// A log change leaves the catalog alone
+	logOnly := *changed
+	logOnly.Log.Level = "error"
+	r.reload(&logOnly, nil)
+	if r.current != &logOnly || r.calculator.Catalog().Version != 2 {
+		t.Errorf("Expected the log change applied with catalog version 2, got version %d", r.calculator.Catalog().Version)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/scenario"
+)
+
+// runScenario evaluates a scenario file and prints its schedule:
+//
+//	mortgage-calc scenario [-config config.yml] [-format text|json] scenario.yml
+//
+// It returns the process exit code.
+func runScenario(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("scenario", flag.ContinueOnError)
+	configPath := flags.String("config", "config.yml", "path to the configuration file")
+	format := flags.String("format", "text", "output format: text or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 || (*format != "text" && *format != "json") {
+		fmt.Fprintln(os.Stderr, "usage: mortgage-calc scenario [-config config.yml] [-format text|json] scenario.yml")
+		return 2
+	}
+
+	path := flags.Arg(0)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	s, err := scenario.Parse(data)
+	if err != nil {
+		// Prefix every error with the file name as compilers do
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, line)
+		}
+		return 1
+	}
+
+	cfg, err := checkConfig(*configPath, nil)
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *configPath, line)
+		}
+		return 1
+	}
+
+	result, err := newCalculator(cfg).Evaluate(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(result); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	printSchedule(out, result)
+
+	return 0
+}
+
+// printSchedule renders the schedule as an aligned table followed by the totals
+func printSchedule(out io.Writer, result model.ScenarioResult) {
+	if result.Name != "" {
+		fmt.Fprintf(out, "%s\n\n", result.Name)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "#\tdate\trate\tpayment\tinterest\tprincipal\tprepayment\tbalance\tdeferred\tevents\t")
+	for _, row := range result.Schedule {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			row.Number, row.Date, row.Rate, row.Payment.StringFixed(2), row.Interest.StringFixed(2),
+			row.Principal.StringFixed(2), row.Prepayment.StringFixed(2), row.Balance.StringFixed(2),
+			row.Deferred.StringFixed(2), strings.Join(row.Events, ","))
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\nprogram: %s\nloan sum: %s\npayments: %d\ntotal paid: %s\noverpayment: %s\nlast payment: %s\n",
+		result.Program, result.LoanSum, result.Payments, result.TotalPaid.StringFixed(2),
+		result.Overpayment.StringFixed(2), result.LastPaymentDate)
+}
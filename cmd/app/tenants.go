@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/velvetriddles/mortgage-calc/internal/cache"
+	"github.com/velvetriddles/mortgage-calc/internal/config"
+	"github.com/velvetriddles/mortgage-calc/internal/handler"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+	"github.com/velvetriddles/mortgage-calc/internal/tenant"
+)
+
+// site is the calculator of our own site or of a tenant, with its own cache
+// so that partners never see the calculations of each other
+type site struct {
+	calculator *service.MortCalculator
+	cache      *cache.MortCache
+}
+
+// handler serves the calculator API of the site, code is empty for our own
+// site and admin is nil for the sites without the admin API
+func (s *site) handler(code string, branding map[string]string, location *time.Location, admin http.Handler) http.Handler {
+	mux := http.NewServeMux()
+
+	mortHandler := handler.NewMortHandler(s.cache, s.calculator, location)
+	eligibilityHandler := handler.NewEligibilityHandler(s.calculator)
+	impliedRateHandler := handler.NewImpliedRateHandler(s.calculator, location)
+	scenarioHandler := handler.NewScenarioHandler(s.calculator)
+	offersHandler := handler.NewOffersHandler(s.calculator, location)
+	brandingHandler := handler.NewBrandingHandler(code, branding)
+
+	mux.HandleFunc("/execute", mortHandler.Execute)
+	mux.HandleFunc("/cache", mortHandler.GetCache)
+	mux.HandleFunc("/eligibility", eligibilityHandler.Check)
+	mux.HandleFunc("/implied-rate", impliedRateHandler.Solve)
+	mux.HandleFunc("/scenario", scenarioHandler.Evaluate)
+	mux.HandleFunc("/offers", offersHandler.Compare)
+	mux.HandleFunc("/branding", brandingHandler.Get)
+
+	if admin != nil {
+		mux.Handle(handler.AdminProgramsPath, admin)
+		mux.Handle(handler.AdminProgramsPath+"/", admin)
+	}
+
+	return mux
+}
+
+// sites serves our own site and the sites of the tenants through the router
+type sites struct {
+	router   *tenant.Router
+	location *time.Location
+	// admin manages the catalog of our own site, nil when the admin API is disabled
+	admin   http.Handler
+	main    *site
+	tenants map[string]*site
+}
+
+// set serves the tenants of the configuration with their catalogs from
+// tenantCatalogs. A tenant kept by its code keeps its cache.
+func (s *sites) set(cfg *config.Config, catalogs [][]service.Program) error {
+	routes := tenantRoutes(cfg)
+	if err := tenant.Validate(routes); err != nil {
+		return err
+	}
+
+	tenants := make(map[string]*site, len(cfg.Tenants))
+	for i, t := range cfg.Tenants {
+		current, ok := s.tenants[t.Code]
+		if !ok {
+			current = &site{calculator: newTenantCalculator(cfg), cache: cache.NewMortCache()}
+			current.cache.SetMaxItems(cfg.Cache.MaxItems)
+		}
+		// The catalogs were validated by tenantCatalogs
+		if err := current.calculator.SetPrograms(catalogs[i]); err != nil {
+			return fmt.Errorf("tenants.%s: %w", t.Code, err)
+		}
+
+		tenants[t.Code] = current
+		routes[i].Handler = current.handler(t.Code, t.Branding, s.location, nil)
+	}
+
+	if err := s.router.Set(s.main.handler("", cfg.Branding, s.location, s.admin), routes); err != nil {
+		return err
+	}
+	s.tenants = tenants
+
+	return nil
+}
+
+// tenantRoutes are the tenants of the configuration without their handlers
+func tenantRoutes(cfg *config.Config) []tenant.Tenant {
+	routes := make([]tenant.Tenant, len(cfg.Tenants))
+	for i, t := range cfg.Tenants {
+		routes[i] = tenant.Tenant{Code: t.Code, Hosts: t.Hosts, APIKeys: t.APIKeys}
+	}
+
+	return routes
+}
+
+// tenantCatalogs returns the program catalogs of the tenants in their order,
+// checked as the calculator would
+func tenantCatalogs(cfg *config.Config) ([][]service.Program, error) {
+	if err := tenant.Validate(tenantRoutes(cfg)); err != nil {
+		return nil, err
+	}
+
+	catalogs := make([][]service.Program, len(cfg.Tenants))
+	for i, t := range cfg.Tenants {
+		programs, err := tenantCatalog(cfg, t)
+		if err == nil {
+			err = service.NewMortCalculator().SetPrograms(programs)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tenants.%s: %w", t.Code, err)
+		}
+		catalogs[i] = programs
+	}
+
+	return catalogs, nil
+}
+
+// tenantCatalog returns the programs of the tenant, or the configured catalog
+// of our own site when the tenant has none, with the tenant's limit overrides applied
+func tenantCatalog(cfg *config.Config, t config.TenantConfig) ([]service.Program, error) {
+	if len(t.Programs) > 0 {
+		return catalogFromConfig(t.Programs, t.Limits)
+	}
+
+	programs, err := catalogFromConfig(cfg.Programs, cfg.Limits)
+	if err != nil {
+		return nil, err
+	}
+
+	return withLimits(programs, t.Limits)
+}
+
+// newTenantCalculator creates the calculator of a tenant, its catalog is set
+// apart and changes through the configuration only
+func newTenantCalculator(cfg *config.Config) *service.MortCalculator {
+	calculator := service.NewMortCalculator()
+	if contributions := militaryContributions(cfg); contributions != nil {
+		calculator.SetMilitaryContributions(contributions)
+	}
+
+	return calculator
+}
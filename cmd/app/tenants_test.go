@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/velvetriddles/mortgage-calc/internal/config"
+	"github.com/velvetriddles/mortgage-calc/internal/tenant"
+)
+
+// serve sends the request to the sites of the reloader as the partner with the API key
+func serve(r *reloader, method, path, body, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if apiKey != "" {
+		req.Header.Set(tenant.APIKeyHeader, apiKey)
+	}
+	rr := httptest.NewRecorder()
+	r.sites.router.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// TestSites_Reload checks that a tenant kept by a reload keeps its cache
+// and that a removed tenant is no longer served
+func TestSites_Reload(t *testing.T) {
+	cfg := config.New()
+	cfg.Tenants = []config.TenantConfig{{
+		Code:     "partner",
+		APIKeys:  []string{"partner-key"},
+		Branding: map[string]string{"title": "Partner mortgage"},
+	}}
+	r := newTestReloader(t, cfg)
+
+	body := `{"object_cost": 5000000, "initial_payment": 1000000, "months": 240, "program": "salary"}`
+	if rr := serve(r, "POST", "/execute", body, "partner-key"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := serve(r, "GET", "/cache", "", ""); rr.Code == http.StatusOK {
+		t.Errorf("Expected the calculation of the partner not to be in our own cache, got %s", rr.Body.String())
+	}
+
+	// New texts of the partner apply, its cache stays
+	rebranded := *cfg
+	rebranded.Tenants = []config.TenantConfig{cfg.Tenants[0]}
+	rebranded.Tenants[0].Branding = map[string]string{"title": "Partner loans"}
+	r.reload(&rebranded, nil)
+
+	if rr := serve(r, "GET", "/branding", "", "partner-key"); !strings.Contains(rr.Body.String(), "Partner loans") {
+		t.Errorf("Expected the new texts of the partner, got %s", rr.Body.String())
+	}
+	if rr := serve(r, "GET", "/cache", "", "partner-key"); rr.Code != http.StatusOK {
+		t.Errorf("Expected the cache of the partner to survive the reload, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// A removed partner is no longer served
+	removed := rebranded
+	removed.Tenants = nil
+	r.reload(&removed, nil)
+
+	if rr := serve(r, "GET", "/cache", "", "partner-key"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code %d for the key of a removed tenant, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if len(r.sites.tenants) != 0 {
+		t.Errorf("Expected the sites of removed tenants to be dropped, got %d", len(r.sites.tenants))
+	}
+}
@@ -29,9 +29,12 @@ type Cache interface {
 
 // MortCache represents a thread-safe implementation of cache for mortgage calculation results
 type MortCache struct {
-	items  map[int]model.ExecuteResponse
-	mu     sync.RWMutex
-	nextID int32 // Using atomic for generating unique IDs
+	items map[int]model.ExecuteResponse
+	// order are the IDs of the items from the oldest
+	order    []int
+	maxItems int
+	mu       sync.RWMutex
+	nextID   int32 // Using atomic for generating unique IDs
 }
 
 // NewMortCache creates a new cache instance
@@ -51,10 +54,34 @@ func (c *MortCache) Save(resp model.ExecuteResponse) int {
 	defer c.mu.Unlock()
 
 	c.items[id] = resp
+	c.order = append(c.order, id)
+	c.evict()
 
 	return id
 }
 
+// SetMaxItems limits the number of items, the oldest items are evicted first.
+// Zero removes the limit.
+func (c *MortCache) SetMaxItems(maxItems int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.maxItems = maxItems
+	c.evict()
+}
+
+// evict removes the oldest items over the limit, the caller holds the lock
+func (c *MortCache) evict() {
+	if c.maxItems <= 0 {
+		return
+	}
+
+	for len(c.order) > c.maxItems {
+		delete(c.items, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
 // GetAll returns all stored in the cache elements
 func (c *MortCache) GetAll() ([]CachedItem, error) {
 	c.mu.RLock()
@@ -84,6 +111,7 @@ func (c *MortCache) Clear() {
 	// Create a new map instead of clearing the existing one
 	// this is more efficient for GC
 	c.items = make(map[int]model.ExecuteResponse)
+	c.order = nil
 }
 
 // Size returns the number of elements in the cache
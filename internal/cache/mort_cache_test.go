@@ -20,9 +20,7 @@ func TestMortCache_Save_GetAll(t *testing.T) {
 			InitialPayment: decimal.NewFromInt(1000000),
 			Months:         240,
 		},
-		Program: model.ProgramRequest{
-			Salary: true,
-		},
+		Program: model.ProgramRequest{Code: "salary"},
 		Aggregates: model.Aggregates{
 			Rate:            decimal.NewFromFloat(8.0),
 			LoanSum:         decimal.NewFromInt(4000000),
@@ -68,9 +66,7 @@ func TestMortCache_Clear_Size(t *testing.T) {
 			InitialPayment: decimal.NewFromInt(1000000),
 			Months:         240,
 		},
-		Program: model.ProgramRequest{
-			Salary: true,
-		},
+		Program: model.ProgramRequest{Code: "salary"},
 		Aggregates: model.Aggregates{
 			Rate:            decimal.NewFromFloat(8.0),
 			LoanSum:         decimal.NewFromInt(4000000),
@@ -118,9 +114,7 @@ func TestMortCache_Parallel(t *testing.T) {
 			InitialPayment: decimal.NewFromInt(1000000),
 			Months:         240,
 		},
-		Program: model.ProgramRequest{
-			Salary: true,
-		},
+		Program: model.ProgramRequest{Code: "salary"},
 		Aggregates: model.Aggregates{
 			Rate:            decimal.NewFromFloat(8.0),
 			LoanSum:         decimal.NewFromInt(4000000),
@@ -168,3 +162,39 @@ func TestMortCache_Parallel(t *testing.T) {
 		}
 	}
 }
+
+func TestMortCache_MaxItems(t *testing.T) {
+	cache := NewMortCache()
+	for i := 0; i < 5; i++ {
+		cache.Save(model.ExecuteResponse{})
+	}
+
+	// Lowering the limit evicts the oldest items at once
+	cache.SetMaxItems(3)
+	if size := cache.Size(); size != 3 {
+		t.Fatalf("Expected 3 items, got %d", size)
+	}
+
+	cache.Save(model.ExecuteResponse{})
+
+	items, err := cache.GetAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ids := make(map[int]bool)
+	for _, item := range items {
+		ids[item.ID] = true
+	}
+	if len(ids) != 3 || !ids[3] || !ids[4] || !ids[5] {
+		t.Errorf("Expected the newest items 3, 4 and 5, got %v", ids)
+	}
+
+	// Clearing keeps the limit
+	cache.Clear()
+	for i := 0; i < 5; i++ {
+		cache.Save(model.ExecuteResponse{})
+	}
+	if size := cache.Size(); size != 3 {
+		t.Errorf("Expected 3 items, got %d", size)
+	}
+}
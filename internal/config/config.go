@@ -1,33 +1,346 @@
 package config
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/velvetriddles/mortgage-calc/internal/logging"
 )
 
+// LimitsConfig overrides the loan limits of a program, zero values mean no limit
+type LimitsConfig struct {
+	MinLoan   float64 `mapstructure:"min_loan"`
+	MaxLoan   float64 `mapstructure:"max_loan"`
+	MinMonths int     `mapstructure:"min_months"`
+	MaxMonths int     `mapstructure:"max_months"`
+	// Regions maps a region code to its loan cap
+	Regions map[string]float64 `mapstructure:"regions"`
+}
+
+// TierConfig is a loan-to-value tier: the rate for initial payments of at least MinInitialPayment percent
+type TierConfig struct {
+	MinInitialPayment float64 `mapstructure:"min_initial_payment"`
+	Rate              float64 `mapstructure:"rate"`
+}
+
+// RatePeriodConfig is a rate table of a program effective from a date
+type RatePeriodConfig struct {
+	// EffectiveFrom is an unquoted YAML date such as 2024-03-01
+	EffectiveFrom time.Time `mapstructure:"effective_from"`
+	// Rate and MinInitialPayment define the first rate tier of the period
+	Rate              float64      `mapstructure:"rate"`
+	MinInitialPayment float64      `mapstructure:"min_initial_payment"`
+	Tiers             []TierConfig `mapstructure:"tiers"`
+}
+
+// RuleConfig is an eligibility rule of a program in the rule expression language
+type RuleConfig struct {
+	Name       string `mapstructure:"name"`
+	Condition  string `mapstructure:"condition"`
+	Expression string `mapstructure:"expression"`
+}
+
+// ProgramConfig describes a program of the catalog
+type ProgramConfig struct {
+	Code string `mapstructure:"code"`
+	Name string `mapstructure:"name"`
+	// Lender is the bank offering the program, empty for our own programs
+	Lender string `mapstructure:"lender"`
+	// IssueFee is a one-time fee paid at signing, percent of the loan sum
+	IssueFee float64 `mapstructure:"issue_fee"`
+	// Feature is the feature flag the program is rolled out with
+	Feature string `mapstructure:"feature"`
+	// Rate and MinInitialPayment define the first rate tier
+	Rate              float64 `mapstructure:"rate"`
+	MinInitialPayment float64 `mapstructure:"min_initial_payment"`
+	// Tiers are additional tiers for larger initial payments
+	Tiers []TierConfig `mapstructure:"tiers"`
+	// Rates replace the tiers above from their effective dates
+	Rates []RatePeriodConfig `mapstructure:"rates"`
+	// Modifiers are codes of the rate modifiers the program offers
+	Modifiers []string `mapstructure:"modifiers"`
+	// Eligibility are names of the built-in eligibility rules of the program
+	Eligibility []string `mapstructure:"eligibility"`
+	// Rules are the program's own eligibility rules
+	Rules  []RuleConfig `mapstructure:"rules"`
+	Limits LimitsConfig `mapstructure:"limits"`
+}
+
+// FeatureConfig is a feature flag, enabled for the listed clients and a
+// percentage of the others
+type FeatureConfig struct {
+	Name       string   `mapstructure:"name"`
+	Percentage int      `mapstructure:"percentage"`
+	Clients    []string `mapstructure:"clients"`
+}
+
+// TenantConfig is a partner site served by the same server with its own
+// programs, limits and texts
+type TenantConfig struct {
+	Code string `mapstructure:"code"`
+	// Hosts are the host names of the partner site, requests for them are
+	// served for the tenant
+	Hosts []string `mapstructure:"hosts"`
+	// APIKeys identify the partner in the X-API-Key header of its requests.
+	// When set, requests for the Hosts must carry one of them too.
+	APIKeys []string `mapstructure:"api_keys" secret:"true"`
+	// Branding are the texts of the partner site by name
+	Branding map[string]string `mapstructure:"branding"`
+	// Programs replace the catalog of the server for the tenant when not empty
+	Programs []ProgramConfig `mapstructure:"programs"`
+	// Limits by program code replace the limits of a program of the tenant
+	Limits map[string]LimitsConfig `mapstructure:"limits"`
+}
+
+// LogConfig controls the request log
+type LogConfig struct {
+	// Level is "info" to log every request or "error" to log failed requests only
+	Level string `mapstructure:"level"`
+	// Format is "text" or "json" for one JSON object per request
+	Format string `mapstructure:"format"`
+}
+
+// ServerConfig controls the HTTP server
+type ServerConfig struct {
+	// Address is the listen address such as 127.0.0.1:8080, all interfaces
+	// on Port when empty
+	Address      string        `mapstructure:"address"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+}
+
+// CacheConfig limits the cache of calculation results
+type CacheConfig struct {
+	// MaxItems is the number of results kept, the oldest are evicted first.
+	// Zero keeps every result.
+	MaxItems int `mapstructure:"max_items"`
+}
+
+// Config is the configuration of the service. Every setting is read, in order
+// of precedence, from the command line flags, MORTGAGE_* environment variables,
+// the configuration file and the defaults of New. Nested keys are joined with
+// an underscore in the environment: server.read_timeout is MORTGAGE_SERVER_READ_TIMEOUT.
 type Config struct {
-	Port int
+	Port   int
+	Server ServerConfig `mapstructure:"server"`
+	// Timezone is the IANA name used to determine the current date,
+	// UTC when empty
+	Timezone string
+	// MilitaryContributions are the annual state contributions of the
+	// military program by year, the built-in table is used when empty
+	MilitaryContributions map[int]float64 `mapstructure:"military_contributions"`
+	// Programs replace the built-in program catalog when not empty
+	Programs []ProgramConfig `mapstructure:"programs"`
+	// Limits by program code replace the limits of a catalog program
+	Limits map[string]LimitsConfig `mapstructure:"limits"`
+	// ProgramsFile keeps the catalog changed through the admin API,
+	// a saved catalog takes precedence over Programs
+	ProgramsFile string `mapstructure:"programs_file"`
+	// AdminToken is the bearer token of the admin API, the API is disabled when empty
+	AdminToken string      `mapstructure:"admin_token" secret:"true"`
+	Log        LogConfig   `mapstructure:"log"`
+	Cache      CacheConfig `mapstructure:"cache"`
+	// Features are the feature flags evaluated for every request
+	Features []FeatureConfig `mapstructure:"features"`
+	// Branding are the texts of the site served for requests of no tenant
+	Branding map[string]string `mapstructure:"branding"`
+	// Tenants are the partner sites, each with its own catalog and cache
+	Tenants []TenantConfig `mapstructure:"tenants"`
+}
+
+// envPrefix is the prefix of the environment variables overriding the file
+const envPrefix = "MORTGAGE"
+
+// flagKeys maps the command line flags to the settings they override
+var flagKeys = map[string]string{
+	"port":            "port",
+	"address":         "server.address",
+	"read-timeout":    "server.read_timeout",
+	"write-timeout":   "server.write_timeout",
+	"idle-timeout":    "server.idle_timeout",
+	"timezone":        "timezone",
+	"programs-file":   "programs_file",
+	"log-level":       "log.level",
+	"log-format":      "log.format",
+	"cache-max-items": "cache.max_items",
+}
+
+// RegisterFlags defines the command line flags overriding the settings on flags
+func RegisterFlags(flags *flag.FlagSet) {
+	flags.Int("port", 0, "port to listen on, when no address is set")
+	flags.String("address", "", "address to listen on, such as 127.0.0.1:8080")
+	flags.Duration("read-timeout", 0, "maximum duration of reading a request")
+	flags.Duration("write-timeout", 0, "maximum duration of writing a response")
+	flags.Duration("idle-timeout", 0, "maximum time to wait for the next request on a keep-alive connection")
+	flags.String("timezone", "", "IANA timezone used to determine the current date")
+	flags.String("programs-file", "", "file keeping the catalog changed through the admin API")
+	flags.String("log-level", "", "request log level: info or error")
+	flags.String("log-format", "", "request log format: text or json")
+	flags.Int("cache-max-items", 0, "number of calculation results kept, 0 keeps all")
 }
 
-func LoadConfig(path string) (*Config, error) {
-	viper.SetConfigFile(path)
-	viper.SetConfigType("yaml")
+// LoadConfig reads the configuration from the file at path, the environment
+// and the flags set on the command line. flags may be nil, and an empty path
+// reads no file. Unknown fields, values of the wrong type and settings out of
+// range are returned together as Errors.
+func LoadConfig(path string, flags *flag.FlagSet) (*Config, error) {
+	// A fresh instance, so that a broken file does not leave stale settings behind
+	v := viper.New()
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("error reading configuration file: %w", err)
+	// Defaults make every setting known to viper, which only looks up the
+	// environment for known keys
+	setDefaults(v, "", reflect.ValueOf(*New()))
+
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	if flags != nil {
+		flags.Visit(func(f *flag.Flag) {
+			if key, ok := flagKeys[f.Name]; ok {
+				v.Set(key, f.Value.String())
+			}
+		})
+	}
+
+	var positions map[string]*yaml.Node
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading configuration file: %w", err)
+		}
+
+		// The file is checked strictly before viper converts its values loosely
+		file, err := checkFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("error reading configuration file: %w", err)
+		}
+		if len(file.errs) > 0 {
+			sortErrors(file.errs)
+			return nil, file.errs
+		}
+		positions = file.positions
+
+		v.SetConfigType("yaml")
+		if err = v.ReadConfig(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("error reading configuration file: %w", err)
+		}
 	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("error parsing configuration: %w", err)
 	}
 
+	// Problems with settings overridden by the environment or the flags are not in the file
+	if positions != nil {
+		for _, key := range v.AllKeys() {
+			if _, ok := os.LookupEnv(envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))); ok {
+				positions[key] = nil
+			}
+		}
+		if flags != nil {
+			flags.Visit(func(f *flag.Flag) {
+				if key, ok := flagKeys[f.Name]; ok {
+					positions[key] = nil
+				}
+			})
+		}
+	}
+
+	if err := config.validate(positions); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+// settleDelay is how long the file must stay unchanged before it is read again.
+// Editors truncate and write in separate steps, reading in between would see
+// an empty configuration.
+const settleDelay = 200 * time.Millisecond
+
+// setDefaults sets the fields of the defaults as the defaults of their keys,
+// maps and lists have no defaults
+func setDefaults(v *viper.Viper, prefix string, defaults reflect.Value) {
+	for i := 0; i < defaults.NumField(); i++ {
+		field, value := defaults.Type().Field(i), defaults.Field(i)
+		key := join(prefix, fieldKey(field))
+		switch value.Kind() {
+		case reflect.Struct:
+			setDefaults(v, key, value)
+		case reflect.Map, reflect.Slice:
+		default:
+			v.SetDefault(key, value.Interface())
+		}
+	}
+}
+
+// Watch reads the configuration again every time the file changes and passes
+// the result to onChange. A file that cannot be read or parsed is passed as an error.
+func Watch(path string, flags *flag.FlagSet, onChange func(cfg *Config, err error)) {
+	var (
+		mu    sync.Mutex
+		timer *time.Timer
+	)
+
+	watcher := viper.New()
+	watcher.SetConfigFile(path)
+	watcher.SetConfigType("yaml")
+	watcher.OnConfigChange(func(fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(settleDelay, func() {
+			onChange(LoadConfig(path, flags))
+		})
+	})
+	watcher.WatchConfig()
+}
+
 func New() *Config {
 	return &Config{
-		Port: 8080,
+		Port:     8080,
+		Timezone: "UTC",
+		Server: ServerConfig{
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			IdleTimeout:  2 * time.Minute,
+		},
+		Log:   LogConfig{Level: logging.LevelInfo, Format: logging.FormatText},
+		Cache: CacheConfig{MaxItems: 10000},
 	}
 }
+
+// ListenAddress is the address the server listens on
+func (c *Config) ListenAddress() string {
+	if c.Server.Address != "" {
+		return c.Server.Address
+	}
+
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// Location resolves the configured timezone
+func (c *Config) Location() (*time.Location, error) {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+	}
+
+	return loc, nil
+}
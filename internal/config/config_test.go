@@ -0,0 +1,283 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		Port:       8080,
+		AdminToken: "old-secret",
+		Programs: []ProgramConfig{
+			{Code: "salary", Rate: 8, MinInitialPayment: 20},
+			{Code: "base", Rate: 10, MinInitialPayment: 20},
+		},
+		Limits: map[string]LimitsConfig{"salary": {MaxMonths: 360}},
+	}
+	new := &Config{
+		Port:       8080,
+		AdminToken: "new-secret",
+		// Reordered programs are not reported
+		Programs: []ProgramConfig{
+			{Code: "base", Rate: 10, MinInitialPayment: 20},
+			{Code: "salary", Rate: 7.5, MinInitialPayment: 20},
+		},
+		Limits: map[string]LimitsConfig{"salary": {MaxMonths: 300}},
+		Log:    LogConfig{Level: "error"},
+	}
+
+	expected := []string{
+		"admin_token: *** -> ***",
+		"limits.salary.max_months: 360 -> 300",
+		"log.level:  -> error",
+		"programs.salary.rate: 8 -> 7.5",
+	}
+	if changes := Diff(old, new); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %q, got %q", expected, changes)
+	}
+
+	if changes := Diff(new, new); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %q", changes)
+	}
+
+	removed := *new
+	removed.Programs = new.Programs[:1]
+	removed.Limits = map[string]LimitsConfig{"salary": {MaxMonths: 300}, "base": {MaxMonths: 240}}
+	expected = []string{
+		"limits.base: added",
+		"programs.salary: removed",
+	}
+	if changes := Diff(new, &removed); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %q, got %q", expected, changes)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte("port: 8080\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		cfg *Config
+		err error
+	}
+	results := make(chan result, 10)
+	Watch(path, nil, func(cfg *Config, err error) {
+		results <- result{cfg, err}
+	})
+
+	next := func() result {
+		select {
+		case r := <-results:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the change to be reported")
+			return result{}
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("port: 9090\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.err != nil || r.cfg.Port != 9090 {
+		t.Errorf("Expected port 9090, got %+v", r)
+	}
+
+	// Truncating and writing the file is reported once
+	time.Sleep(2 * settleDelay)
+	if len(results) > 0 {
+		t.Errorf("Expected a single reload for a single write, got %d more", len(results))
+	}
+
+	if err := os.WriteFile(path, []byte("port: [\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.err == nil {
+		t.Errorf("Expected an error for a broken file, got %+v", r.cfg)
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	file := "port: 9000\ntimezone: Europe/Moscow\nserver:\n  read_timeout: 5s\n  write_timeout: 5s\nlog:\n  level: error\n"
+	if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MORTGAGE_PORT", "9100")
+	t.Setenv("MORTGAGE_SERVER_WRITE_TIMEOUT", "7s")
+	t.Setenv("MORTGAGE_LOG_FORMAT", "json")
+	t.Setenv("MORTGAGE_ADMIN_TOKEN", "secret")
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(flags)
+	if err := flags.Parse([]string{"--port", "9200", "--cache-max-items=50"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path, flags)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := New()
+	// Flags
+	expected.Port = 9200
+	expected.Cache.MaxItems = 50
+	// Environment
+	expected.Server.WriteTimeout = 7 * time.Second
+	expected.Log.Format = "json"
+	expected.AdminToken = "secret"
+	// File
+	expected.Timezone = "Europe/Moscow"
+	expected.Server.ReadTimeout = 5 * time.Second
+	expected.Log.Level = "error"
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, cfg)
+	}
+	if address := cfg.ListenAddress(); address != ":9200" {
+		t.Errorf("Expected address :9200, got %s", address)
+	}
+
+	// Without a file the environment and the flags apply over the defaults
+	if cfg, err = LoadConfig("", flags); err != nil || cfg.Port != 9200 || cfg.Log.Level != "info" || cfg.Log.Format != "json" {
+		t.Errorf("Expected the defaults with overrides, got %+v, %v", cfg, err)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg := New()
+	cfg.AdminToken = "secret"
+	cfg.Server.Address = "127.0.0.1:8080"
+	cfg.Limits = map[string]LimitsConfig{"base": {MaxMonths: 300, Regions: map[string]float64{"moscow": 12000000}}}
+	cfg.Programs = []ProgramConfig{{
+		Code:              "salary",
+		Name:              "Corporate client",
+		Rate:              8,
+		MinInitialPayment: 20,
+		Rates: []RatePeriodConfig{
+			{EffectiveFrom: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Rate: 7.5, MinInitialPayment: 20},
+		},
+		Modifiers: []string{"e_registration"},
+	}}
+	cfg.Tenants = []TenantConfig{{
+		Code:     "partner",
+		Hosts:    []string{"calc.partner.example"},
+		APIKeys:  []string{"partner-key"},
+		Branding: map[string]string{"title": "Partner mortgage"},
+	}}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	printed := out.String()
+
+	for _, line := range []string{"admin_token: '***'", "  read_timeout: 10s", "  address: 127.0.0.1:8080", "      - '***'"} {
+		if !strings.Contains(printed, line+"\n") {
+			t.Errorf("Expected %q in\n%s", line, printed)
+		}
+	}
+	if strings.Contains(printed, "secret") || strings.Contains(printed, "partner-key") {
+		t.Errorf("Expected the admin token and the API keys to be masked in\n%s", printed)
+	}
+
+	// The output reads back as the same configuration
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConfig(path, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if changes := Diff(cfg, loaded); !reflect.DeepEqual(changes, []string{"admin_token: *** -> ***", "tenants.partner.api_keys: *** -> ***"}) {
+		t.Errorf("Expected the printed configuration to read back, got changes %q", changes)
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		expected []string
+	}{
+		{
+			name: "types and unknown fields",
+			file: "port: \"8080\"\nprot: 8080\nserver:\n  read_timeout: 10\nmilitary_contributions:\n  last: 1\n" +
+				"programs:\n  - code: base\n    tiers: 5\n    rates:\n      - effective_from: soon\n",
+			expected: []string{
+				`line 1, column 7: port: expected an integer, got "8080"`,
+				"line 2, column 1: prot: unknown field",
+				`line 4, column 17: server.read_timeout: expected a duration such as 10s or 2m, got "10"`,
+				"line 6, column 3: military_contributions.last: expected an integer key",
+				`line 9, column 12: programs[0].tiers: expected a list, got "5"`,
+				`line 11, column 25: programs[0].rates[0].effective_from: expected a date such as 2024-03-01, got "soon"`,
+			},
+		},
+		{
+			name: "ranges and required fields",
+			file: "log:\n  level: debug\nlimits:\n  base:\n    min_months: 400\n    max_months: 360\n" +
+				"programs:\n  - code: base\n    rate: 0\n    min_initial_payment: 120\n    feature: new_base\n" +
+				"features:\n  - name: rounding\n    percentage: 120\n",
+			env: map[string]string{"MORTGAGE_PORT": "0"},
+			expected: []string{
+				`line 2, column 10: log.level: unknown log level "debug", expected "info" or "error"`,
+				"line 5, column 17: limits.base.min_months: must not exceed max_months 360, got 400",
+				"line 8, column 5: programs[0].name: is required",
+				"line 9, column 11: programs[0].rate: must be positive, got 0",
+				"line 10, column 26: programs[0].min_initial_payment: must be from 0 to 100, got 120",
+				"line 11, column 14: programs[0].feature: unknown feature new_base, add it to features",
+				"line 14, column 17: features[0].percentage: must be from 0 to 100, got 120",
+				// Overridden by the environment, so not located in the file
+				"port: must be from 1 to 65535, got 0",
+			},
+		},
+		{
+			name: "tenants",
+			file: "tenants:\n  - code: alfa\n    hosts: [calc.alfa.example]\n    api_keys: [shared]\n" +
+				"  - code: alfa\n    hosts: [CALC.alfa.example]\n    api_keys: [shared]\n" +
+				"    programs:\n      - code: base\n        name: Base\n        rate: -1\n" +
+				"  - code: beta\n",
+			expected: []string{
+				"line 5, column 11: tenants[1].code: duplicate tenant alfa",
+				"line 6, column 13: tenants[1].hosts[0]: host CALC.alfa.example belongs to tenant alfa",
+				"line 7, column 16: tenants[1].api_keys[0]: duplicate API key",
+				"line 11, column 15: tenants[1].programs[0].rate: must be positive, got -1",
+				"line 12, column 5: tenants[2]: a host or an API key is required to route requests to the tenant",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			path := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadConfig(path, nil)
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected Errors, got %v", err)
+			}
+			if messages := strings.Split(errs.Error(), "\n"); !reflect.DeepEqual(messages, tt.expected) {
+				t.Errorf("Expected errors\n%s\ngot\n%s", strings.Join(tt.expected, "\n"), errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// secretPrefix marks values of fields tagged secret:"true", which are compared
+// but never printed
+const secretPrefix = "\x00secret:"
+
+// entry marks map entries and slice elements, so that an added or removed
+// program is reported once rather than field by field
+const entry = "\x00entry"
+
+// Diff lists the settings that differ between two configurations, one line per
+// setting in the form "key: old -> new". Programs are keyed by their code.
+func Diff(old, new *Config) []string {
+	before := make(map[string]string)
+	after := make(map[string]string)
+	flatten("", reflect.ValueOf(*old), before)
+	flatten("", reflect.ValueOf(*new), after)
+
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []string
+	skip := ""
+	for _, key := range keys {
+		if skip != "" && strings.HasPrefix(key, skip) {
+			continue
+		}
+		skip = ""
+
+		was, hadBefore := before[key]
+		is, hasAfter := after[key]
+		switch {
+		case !hadBefore && is == entry:
+			changes = append(changes, key+": added")
+			skip = key + "."
+		case !hasAfter && was == entry:
+			changes = append(changes, key+": removed")
+			skip = key + "."
+		case !hadBefore:
+			changes = append(changes, fmt.Sprintf("%s: added %s", key, printable(is)))
+		case !hasAfter:
+			changes = append(changes, fmt.Sprintf("%s: removed %s", key, printable(was)))
+		case was != is:
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, printable(was), printable(is)))
+		}
+	}
+
+	return changes
+}
+
+// flatten collects the leaf values of v by their dotted mapstructure keys
+func flatten(prefix string, v reflect.Value, out map[string]string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if stringer, ok := v.Interface().(fmt.Stringer); ok {
+			out[prefix] = stringer.String()
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := fieldKey(field)
+			if field.Tag.Get("secret") == "true" {
+				out[join(prefix, name)] = secretPrefix + fmt.Sprint(v.Field(i).Interface())
+				continue
+			}
+			flatten(join(prefix, name), v.Field(i), out)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			flattenEntry(join(prefix, fmt.Sprint(key.Interface())), v.MapIndex(key), out)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			flattenEntry(join(prefix, elementKey(v.Index(i), i)), v.Index(i), out)
+		}
+	default:
+		out[prefix] = fmt.Sprint(v.Interface())
+	}
+}
+
+func flattenEntry(key string, v reflect.Value, out map[string]string) {
+	if v.Kind() == reflect.Struct || v.Kind() == reflect.Map || v.Kind() == reflect.Slice {
+		out[key] = entry
+	}
+	flatten(key, v, out)
+}
+
+// elementKey identifies a slice element by its code or name when it has one,
+// so that reordering programs or feature flags is not reported as a change
+func elementKey(v reflect.Value, i int) string {
+	if v.Kind() == reflect.Struct {
+		for _, field := range []string{"Code", "Name"} {
+			if key := v.FieldByName(field); key.IsValid() && key.Kind() == reflect.String && key.String() != "" {
+				return key.String()
+			}
+		}
+	}
+
+	return fmt.Sprint(i)
+}
+
+func printable(value string) string {
+	if value == secretPrefix {
+		return `""`
+	}
+	if strings.HasPrefix(value, secretPrefix) {
+		return "***"
+	}
+
+	return value
+}
+
+// fieldKey is the configuration key of a struct field
+func fieldKey(field reflect.StructField) string {
+	if name := field.Tag.Get("mapstructure"); name != "" {
+		return name
+	}
+
+	return strings.ToLower(field.Name)
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "." + name
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Print writes the configuration as YAML in the layout of the configuration
+// file, so that the output can be used as one. Secrets are printed as ***.
+func (c *Config) Print(w io.Writer) error {
+	node, err := toNode(reflect.ValueOf(*c))
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(node); err != nil {
+		return fmt.Errorf("error printing configuration: %w", err)
+	}
+
+	return encoder.Close()
+}
+
+// toNode converts a value to a YAML node keyed by the mapstructure keys,
+// struct fields keep their order
+func toNode(v reflect.Value) (*yaml.Node, error) {
+	if duration, ok := v.Interface().(time.Duration); ok {
+		return scalar(duration.String())
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if _, ok := v.Interface().(time.Time); ok {
+			return scalar(v.Interface())
+		}
+
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			value, err := toNode(v.Field(i))
+			if field.Tag.Get("secret") == "true" && !v.Field(i).IsZero() {
+				value, err = masked(v.Field(i))
+			}
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: fieldKey(field)}, value)
+		}
+
+		return node, nil
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		if len(keys) == 0 {
+			node.Style = yaml.FlowStyle
+		}
+		for _, key := range keys {
+			value, err := toNode(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(key.Interface())}, value)
+		}
+
+		return node, nil
+	case reflect.Float32, reflect.Float64:
+		// Amounts read better as 30000000 than as 3e+07
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatFloat(v.Float(), 'f', -1, 64)}, nil
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		if v.Len() == 0 {
+			node.Style = yaml.FlowStyle
+		}
+		for i := 0; i < v.Len(); i++ {
+			value, err := toNode(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+
+		return node, nil
+	default:
+		return scalar(v.Interface())
+	}
+}
+
+// masked hides a secret, lists keep their length so that the output still
+// reads as a list of secrets
+func masked(v reflect.Value) (*yaml.Node, error) {
+	if v.Kind() != reflect.Slice {
+		return scalar("***")
+	}
+
+	node := &yaml.Node{Kind: yaml.SequenceNode}
+	for i := 0; i < v.Len(); i++ {
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "***"})
+	}
+
+	return node, nil
+}
+
+func scalar(value any) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, fmt.Errorf("error printing configuration: %w", err)
+	}
+
+	return node, nil
+}
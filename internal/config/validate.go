@@ -0,0 +1,404 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/velvetriddles/mortgage-calc/internal/logging"
+)
+
+// Error is a problem with a setting. Line and Column locate it in the file,
+// they are zero for settings from the defaults, the environment or the flags.
+type Error struct {
+	Line    int
+	Column  int
+	Key     string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Key, e.Message)
+	}
+
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Key, e.Message)
+}
+
+// Errors are all problems of a configuration, those in the file first by position
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// checker checks the file against the Config type and remembers where every
+// setting is, so that problems found later in the values point to the file
+type checker struct {
+	errs      Errors
+	positions map[string]*yaml.Node
+}
+
+func (c *checker) errorf(node *yaml.Node, key, format string, args ...any) {
+	c.errs = append(c.errs, &Error{
+		Line:    node.Line,
+		Column:  node.Column,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkFile reports unknown fields and values of the wrong type in the file
+func checkFile(data []byte) (*checker, error) {
+	c := &checker{positions: make(map[string]*yaml.Node)}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		// yaml.v3 syntax errors already carry the line number
+		return nil, err
+	}
+	if len(root.Content) > 0 {
+		c.check(root.Content[0], reflect.TypeOf(Config{}), "")
+	}
+
+	return c, nil
+}
+
+func (c *checker) check(node *yaml.Node, t reflect.Type, key string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	// Viper lowercases the keys
+	c.positions[strings.ToLower(key)] = node
+
+	tag := node.ShortTag()
+	if tag == "!!null" {
+		return
+	}
+
+	switch {
+	case t == durationType:
+		if _, err := time.ParseDuration(node.Value); tag != "!!str" || err != nil {
+			c.errorf(node, key, "expected a duration such as 10s or 2m, got %s", describe(node))
+		}
+		return
+	case t == timeType:
+		if tag != "!!timestamp" {
+			c.errorf(node, key, "expected a date such as 2024-03-01, got %s", describe(node))
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			c.errorf(node, key, "expected a mapping, got %s", describe(node))
+			return
+		}
+
+		fields := make(map[string]reflect.StructField, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			fields[fieldKey(t.Field(i))] = t.Field(i)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[strings.ToLower(name.Value)]
+			if !ok {
+				c.errorf(name, join(key, name.Value), "unknown field")
+				continue
+			}
+			c.check(value, field.Type, join(key, name.Value))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			c.errorf(node, key, "expected a mapping, got %s", describe(node))
+			return
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name, value := node.Content[i], node.Content[i+1]
+			if t.Key().Kind() == reflect.Int && name.ShortTag() != "!!int" {
+				c.errorf(name, join(key, name.Value), "expected an integer key")
+				continue
+			}
+			c.check(value, t.Elem(), join(key, name.Value))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			c.errorf(node, key, "expected a list, got %s", describe(node))
+			return
+		}
+
+		for i, item := range node.Content {
+			c.check(item, t.Elem(), fmt.Sprintf("%s[%d]", key, i))
+		}
+	case reflect.String:
+		if tag != "!!str" {
+			c.errorf(node, key, "expected a string, got %s, quote it to use it as a string", describe(node))
+		}
+	case reflect.Bool:
+		if tag != "!!bool" {
+			c.errorf(node, key, "expected true or false, got %s", describe(node))
+		}
+	case reflect.Int:
+		if tag != "!!int" {
+			c.errorf(node, key, "expected an integer, got %s", describe(node))
+		}
+	case reflect.Float64:
+		if tag != "!!int" && tag != "!!float" {
+			c.errorf(node, key, "expected a number, got %s", describe(node))
+		}
+	}
+}
+
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return strconv.Quote(node.Value)
+	}
+}
+
+// validate checks the ranges and the required fields of the settings. Problems
+// are located with the positions of the settings in the file, positions holds
+// nil for the settings overridden elsewhere.
+func (cfg *Config) validate(positions map[string]*yaml.Node) error {
+	v := &validator{positions: positions}
+
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		v.errorf("port", "must be from 1 to 65535, got %d", cfg.Port)
+	}
+	if cfg.Server.Address != "" {
+		if _, port, err := net.SplitHostPort(cfg.Server.Address); err != nil || port == "" {
+			v.errorf("server.address", "expected host:port such as 127.0.0.1:8080, got %q", cfg.Server.Address)
+		}
+	}
+	timeouts := map[string]time.Duration{
+		"server.read_timeout":  cfg.Server.ReadTimeout,
+		"server.write_timeout": cfg.Server.WriteTimeout,
+		"server.idle_timeout":  cfg.Server.IdleTimeout,
+	}
+	for key, timeout := range timeouts {
+		if timeout < 0 {
+			v.errorf(key, "must not be negative, got %s", timeout)
+		}
+	}
+	if _, err := cfg.Location(); err != nil {
+		v.errorf("timezone", "unknown timezone %q", cfg.Timezone)
+	}
+	if _, err := logging.ParseLevel(cfg.Log.Level); err != nil {
+		v.errorf("log.level", "%v", err)
+	}
+	if _, err := logging.ParseFormat(cfg.Log.Format); err != nil {
+		v.errorf("log.format", "%v", err)
+	}
+	v.notNegative("cache.max_items", float64(cfg.Cache.MaxItems))
+
+	for year, amount := range cfg.MilitaryContributions {
+		if amount <= 0 {
+			v.errorf(join("military_contributions", strconv.Itoa(year)), "must be positive, got %v", amount)
+		}
+	}
+	for code, limits := range cfg.Limits {
+		v.limits(join("limits", code), limits)
+	}
+
+	features := make(map[string]bool, len(cfg.Features))
+	for i, feature := range cfg.Features {
+		key := fmt.Sprintf("features[%d]", i)
+		v.required(join(key, "name"), feature.Name)
+		if features[feature.Name] {
+			v.errorf(join(key, "name"), "duplicate feature %s", feature.Name)
+		}
+		features[feature.Name] = true
+		if feature.Percentage < 0 || feature.Percentage > 100 {
+			v.errorf(join(key, "percentage"), "must be from 0 to 100, got %d", feature.Percentage)
+		}
+	}
+
+	v.programs("programs", cfg.Programs, features)
+
+	codes := make(map[string]bool, len(cfg.Tenants))
+	hosts := make(map[string]string)
+	apiKeys := make(map[string]bool)
+	for i, tenant := range cfg.Tenants {
+		key := fmt.Sprintf("tenants[%d]", i)
+		v.required(join(key, "code"), tenant.Code)
+		if codes[tenant.Code] {
+			v.errorf(join(key, "code"), "duplicate tenant %s", tenant.Code)
+		}
+		codes[tenant.Code] = true
+		if len(tenant.Hosts) == 0 && len(tenant.APIKeys) == 0 {
+			v.errorf(key, "a host or an API key is required to route requests to the tenant")
+		}
+		for j, host := range tenant.Hosts {
+			hostKey := fmt.Sprintf("%s.hosts[%d]", key, j)
+			v.required(hostKey, host)
+			if other, ok := hosts[strings.ToLower(host)]; ok {
+				v.errorf(hostKey, "host %s belongs to tenant %s", host, other)
+			}
+			hosts[strings.ToLower(host)] = tenant.Code
+		}
+		for j, apiKey := range tenant.APIKeys {
+			// The key is a secret, the message does not repeat it
+			apiKeyKey := fmt.Sprintf("%s.api_keys[%d]", key, j)
+			v.required(apiKeyKey, apiKey)
+			if apiKeys[apiKey] {
+				v.errorf(apiKeyKey, "duplicate API key")
+			}
+			apiKeys[apiKey] = true
+		}
+		for code, limits := range tenant.Limits {
+			v.limits(join(join(key, "limits"), code), limits)
+		}
+		v.programs(join(key, "programs"), tenant.Programs, features)
+	}
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	sortErrors(v.errs)
+
+	return v.errs
+}
+
+// validator collects the problems of the decoded settings
+type validator struct {
+	errs      Errors
+	positions map[string]*yaml.Node
+}
+
+// errorf reports a problem at the setting, or at the closest enclosing one in
+// the file when the setting is missing from it
+func (v *validator) errorf(key, format string, args ...any) {
+	err := &Error{Key: key, Message: fmt.Sprintf(format, args...)}
+	at := strings.ToLower(key)
+	for {
+		if node, ok := v.positions[at]; ok {
+			// Settings overridden by the environment or the flags have no position
+			if node != nil {
+				err.Line, err.Column = node.Line, node.Column
+			}
+			break
+		}
+		end := strings.LastIndexAny(at, ".[")
+		if end < 0 {
+			break
+		}
+		at = at[:end]
+	}
+	v.errs = append(v.errs, err)
+}
+
+// programs checks the programs of a catalog, features are the configured feature flags
+func (v *validator) programs(prefix string, programs []ProgramConfig, features map[string]bool) {
+	for i, program := range programs {
+		key := fmt.Sprintf("%s[%d]", prefix, i)
+		v.required(join(key, "code"), program.Code)
+		v.required(join(key, "name"), program.Name)
+		v.percent(join(key, "issue_fee"), program.IssueFee)
+		if program.Feature != "" && !features[program.Feature] {
+			v.errorf(join(key, "feature"), "unknown feature %s, add it to features", program.Feature)
+		}
+		v.tier(key, program.Rate, program.MinInitialPayment)
+		for j, tier := range program.Tiers {
+			v.tier(fmt.Sprintf("%s.tiers[%d]", key, j), tier.Rate, tier.MinInitialPayment)
+		}
+		for j, period := range program.Rates {
+			periodKey := fmt.Sprintf("%s.rates[%d]", key, j)
+			if period.EffectiveFrom.IsZero() {
+				v.errorf(join(periodKey, "effective_from"), "is required")
+			}
+			v.tier(periodKey, period.Rate, period.MinInitialPayment)
+			for k, tier := range period.Tiers {
+				v.tier(fmt.Sprintf("%s.tiers[%d]", periodKey, k), tier.Rate, tier.MinInitialPayment)
+			}
+		}
+		for j, rule := range program.Rules {
+			ruleKey := fmt.Sprintf("%s.rules[%d]", key, j)
+			v.required(join(ruleKey, "name"), rule.Name)
+			v.required(join(ruleKey, "expression"), rule.Expression)
+		}
+		v.limits(join(key, "limits"), program.Limits)
+	}
+}
+
+func (v *validator) required(key, value string) {
+	if value == "" {
+		v.errorf(key, "is required")
+	}
+}
+
+func (v *validator) notNegative(key string, value float64) {
+	if value < 0 {
+		v.errorf(key, "must not be negative, got %v", value)
+	}
+}
+
+func (v *validator) percent(key string, value float64) {
+	if value < 0 || value >= 100 {
+		v.errorf(key, "must be from 0 to 100, got %v", value)
+	}
+}
+
+func (v *validator) tier(key string, rate, minInitialPayment float64) {
+	if rate <= 0 {
+		v.errorf(join(key, "rate"), "must be positive, got %v", rate)
+	}
+	v.percent(join(key, "min_initial_payment"), minInitialPayment)
+}
+
+func (v *validator) limits(key string, limits LimitsConfig) {
+	v.notNegative(join(key, "min_loan"), limits.MinLoan)
+	v.notNegative(join(key, "max_loan"), limits.MaxLoan)
+	v.notNegative(join(key, "min_months"), float64(limits.MinMonths))
+	v.notNegative(join(key, "max_months"), float64(limits.MaxMonths))
+	if limits.MaxLoan > 0 && limits.MinLoan > limits.MaxLoan {
+		v.errorf(join(key, "min_loan"), "must not exceed max_loan %v, got %v", limits.MaxLoan, limits.MinLoan)
+	}
+	if limits.MaxMonths > 0 && limits.MinMonths > limits.MaxMonths {
+		v.errorf(join(key, "min_months"), "must not exceed max_months %d, got %d", limits.MaxMonths, limits.MinMonths)
+	}
+	for region, maxLoan := range limits.Regions {
+		if maxLoan <= 0 {
+			v.errorf(join(join(key, "regions"), region), "must be positive, got %v", maxLoan)
+		}
+	}
+}
+
+// sortErrors orders the problems by their position, those not in the file last
+func sortErrors(errs Errors) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i], errs[j]
+		if (a.Line == 0) != (b.Line == 0) {
+			return b.Line == 0
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+
+		return a.Key < b.Key
+	})
+}
@@ -0,0 +1,159 @@
+// Package features evaluates the feature flags of every request, so that
+// calculation changes and new programs can be rolled out gradually.
+//
+// A flag is enabled for the clients listed in it and for a percentage of the
+// others. Clients are identified by the X-Client-ID header and keep their flags
+// between requests. Requests without it are drawn at random for every flag, so
+// identical anonymous requests may get different features: only X-Client-ID
+// gives a stable assignment.
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+const (
+	// ClientHeader identifies the API client of a request
+	ClientHeader = "X-Client-ID"
+	// Header lists the features enabled for the request in the response
+	Header = "X-Features"
+)
+
+// ErrInvalidFlag occurs for a flag definition that cannot be evaluated
+var ErrInvalidFlag = errors.New("invalid feature flag")
+
+// Flag enables a feature for some of the requests
+type Flag struct {
+	Name string
+	// Percentage of the clients the feature is enabled for, from 0 to 100
+	Percentage int
+	// Clients always get the feature
+	Clients []string
+}
+
+// enabledFor reports whether the feature is enabled for the client, an empty
+// client is an anonymous request drawn with draw, which returns a number in [0, n)
+func (f Flag) enabledFor(client string, draw func(n int) int) bool {
+	// Each flag draws on its own, so that a 10% flag is not always within a 20% one
+	if client == "" {
+		return draw(100) < f.Percentage
+	}
+
+	for _, c := range f.Clients {
+		if c == client {
+			return true
+		}
+	}
+
+	// Each flag buckets the clients on its own, so that raising one flag
+	// does not select the same clients as the others
+	hash := fnv.New32a()
+	hash.Write([]byte(f.Name + "\x00" + client))
+
+	return int(hash.Sum32()%100) < f.Percentage
+}
+
+// Validate checks the flags and the uniqueness of their names
+func Validate(flags []Flag) error {
+	seen := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		if flag.Name == "" {
+			return fmt.Errorf("%w: name is required", ErrInvalidFlag)
+		}
+		if seen[flag.Name] {
+			return fmt.Errorf("%w: duplicate name %s", ErrInvalidFlag, flag.Name)
+		}
+		seen[flag.Name] = true
+
+		if flag.Percentage < 0 || flag.Percentage > 100 {
+			return fmt.Errorf("%w: %s: percentage must be from 0 to 100, got %d", ErrInvalidFlag, flag.Name, flag.Percentage)
+		}
+	}
+
+	return nil
+}
+
+// Flags are the feature flags in effect, they can be replaced while serving
+type Flags struct {
+	flags atomic.Pointer[[]Flag]
+	// rand draws the anonymous requests, a number in [0, n)
+	rand func(n int) int
+}
+
+// NewFlags creates the flags
+func NewFlags(flags []Flag) (*Flags, error) {
+	f := &Flags{rand: rand.Intn}
+	if err := f.Set(flags); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Set replaces the flags evaluated for the next requests
+func (f *Flags) Set(flags []Flag) error {
+	if err := Validate(flags); err != nil {
+		return err
+	}
+
+	copied := append([]Flag(nil), flags...)
+	f.flags.Store(&copied)
+
+	return nil
+}
+
+// Evaluate returns the names of the features enabled for a request of the
+// client, sorted. An empty client is an anonymous request, drawn anew every time.
+func (f *Flags) Evaluate(client string) model.Features {
+	flags := f.flags.Load()
+	if flags == nil {
+		return nil
+	}
+
+	var enabled model.Features
+	for _, flag := range *flags {
+		if flag.enabledFor(client, f.rand) {
+			enabled = append(enabled, flag.Name)
+		}
+	}
+	sort.Strings(enabled)
+
+	return enabled
+}
+
+// Handler evaluates the flags for the requests served by next, which find
+// them with FromContext. The response lists them in the X-Features header.
+func (f *Flags) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enabled := f.Evaluate(r.Header.Get(ClientHeader))
+		if len(enabled) > 0 {
+			w.Header().Set(Header, strings.Join(enabled, ","))
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), enabled)))
+	})
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the features enabled for the request
+func NewContext(ctx context.Context, enabled model.Features) context.Context {
+	return context.WithValue(ctx, contextKey{}, enabled)
+}
+
+// FromContext returns the features enabled for the request, none when the
+// request was not served through Handler
+func FromContext(ctx context.Context) model.Features {
+	enabled, _ := ctx.Value(contextKey{}).(model.Features)
+	return enabled
+}
@@ -0,0 +1,140 @@
+package features
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+func TestEvaluate(t *testing.T) {
+	flags, err := NewFlags([]Flag{
+		{Name: "everyone", Percentage: 100},
+		{Name: "nobody"},
+		{Name: "partners", Clients: []string{"partner-a", "partner-b"}},
+		{Name: "rollout", Percentage: 30},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if enabled := flags.Evaluate("partner-a"); !enabled.Enabled("everyone") || !enabled.Enabled("partners") || enabled.Enabled("nobody") {
+		t.Errorf("Expected everyone and partners for a partner, got %v", enabled)
+	}
+	if enabled := flags.Evaluate(""); !enabled.Enabled("everyone") || enabled.Enabled("partners") {
+		t.Errorf("Expected everyone without partners for an anonymous request, got %v", enabled)
+	}
+
+	// A client keeps its flags, and the rollout reaches about its percentage of clients
+	rolledOut := 0
+	for i := 0; i < 1000; i++ {
+		client := fmt.Sprintf("client-%d", i)
+		enabled := flags.Evaluate(client)
+		if !reflect.DeepEqual(enabled, flags.Evaluate(client)) {
+			t.Fatalf("Expected the same flags for %s, got %v and then others", client, enabled)
+		}
+		if enabled.Enabled("rollout") {
+			rolledOut++
+		}
+	}
+	if rolledOut < 250 || rolledOut > 350 {
+		t.Errorf("Expected about 300 of 1000 clients in the rollout, got %d", rolledOut)
+	}
+
+	// Replaced flags apply to the next requests
+	if err = flags.Set([]Flag{{Name: "nobody", Percentage: 100}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if enabled := flags.Evaluate("partner-a"); !reflect.DeepEqual(enabled, model.Features{"nobody"}) {
+		t.Errorf("Expected [nobody], got %v", enabled)
+	}
+}
+
+// sequence returns a random source drawing the values in turn
+func sequence(t *testing.T, values ...int) func(n int) int {
+	return func(n int) int {
+		if n != 100 {
+			t.Errorf("Expected a draw from 100, got %d", n)
+		}
+		if len(values) == 0 {
+			t.Fatal("Unexpected draw")
+		}
+		v := values[0]
+		values = values[1:]
+
+		return v
+	}
+}
+
+// TestEvaluate_Anonymous checks that every flag draws an anonymous request on
+// its own and that clients are not drawn
+func TestEvaluate_Anonymous(t *testing.T) {
+	flags, _ := NewFlags([]Flag{{Name: "ten", Percentage: 10}, {Name: "twenty", Percentage: 20}})
+
+	tests := []struct {
+		draws    []int
+		expected model.Features
+	}{
+		{draws: []int{5, 50}, expected: model.Features{"ten"}},
+		{draws: []int{15, 15}, expected: model.Features{"twenty"}},
+		{draws: []int{9, 19}, expected: model.Features{"ten", "twenty"}},
+		{draws: []int{10, 20}},
+	}
+	for _, tt := range tests {
+		flags.rand = sequence(t, tt.draws...)
+		if enabled := flags.Evaluate(""); !reflect.DeepEqual(enabled, tt.expected) {
+			t.Errorf("Expected %v for draws %v, got %v", tt.expected, tt.draws, enabled)
+		}
+	}
+
+	flags.rand = sequence(t)
+	flags.Evaluate("partner-a")
+}
+
+func TestSet_Invalid(t *testing.T) {
+	flags, _ := NewFlags([]Flag{{Name: "kept", Percentage: 100}})
+
+	invalid := [][]Flag{
+		{{Percentage: 10}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Percentage: 101}},
+		{{Name: "a", Percentage: -1}},
+	}
+	for _, tt := range invalid {
+		if err := flags.Set(tt); !errors.Is(err, ErrInvalidFlag) {
+			t.Errorf("Expected error %v for %+v, got %v", ErrInvalidFlag, tt, err)
+		}
+	}
+
+	if enabled := flags.Evaluate(""); !reflect.DeepEqual(enabled, model.Features{"kept"}) {
+		t.Errorf("Expected the previous flags to stay, got %v", enabled)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	flags, _ := NewFlags([]Flag{
+		{Name: "rounding", Percentage: 100},
+		{Name: "beta", Clients: []string{"partner-a"}},
+	})
+
+	var seen model.Features
+	handler := flags.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("POST", "/execute", nil)
+	req.Header.Set(ClientHeader, "partner-a")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if expected := (model.Features{"beta", "rounding"}); !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Expected features %v in the context, got %v", expected, seen)
+	}
+	if header := rr.Header().Get(Header); header != "beta,rounding" {
+		t.Errorf("Expected header %s: beta,rounding, got %q", Header, header)
+	}
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// AdminProgramsPath is the root of the program admin API:
+//
+//	GET  /admin/programs                  list the catalog
+//	POST /admin/programs                  create a program
+//	GET  /admin/programs/{code}           get a program
+//	PUT  /admin/programs/{code}           update a program
+//	POST /admin/programs/{code}/deactivate stop offering a program
+//	POST /admin/programs/{code}/activate   offer a program again
+//	POST /admin/programs/{code}/rates      schedule a rate table from a date
+const AdminProgramsPath = "/admin/programs"
+
+// maxProgramSize limits the size of a program definition or rate table
+const maxProgramSize = 1 << 20
+
+type CatalogResponse struct {
+	Result model.Catalog `json:"result"`
+}
+
+type ProgramResponse struct {
+	Result ProgramResult `json:"result"`
+}
+
+// ProgramResult is a program together with the catalog version it belongs to
+type ProgramResult struct {
+	Version int                     `json:"version"`
+	Program model.ProgramDefinition `json:"program"`
+}
+
+type AdminHandler struct {
+	admin service.ProgramAdmin
+	token string
+}
+
+// NewAdminHandler creates the handler, requests must carry the token as a bearer token
+func NewAdminHandler(admin service.ProgramAdmin, token string) *AdminHandler {
+	return &AdminHandler{
+		admin: admin,
+		token: token,
+	}
+}
+
+// ServeHTTP routes the admin API by method and path
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeErrorResponse(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminProgramsPath), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		writeJSON(w, CatalogResponse{Result: h.admin.Catalog()}, http.StatusOK)
+	case rest == "" && r.Method == http.MethodPost:
+		h.create(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		h.get(w, parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		h.update(w, r, parts[0])
+	case len(parts) == 2 && r.Method == http.MethodPost && (parts[1] == "activate" || parts[1] == "deactivate"):
+		h.setActive(w, parts[0], parts[1] == "activate")
+	case len(parts) == 2 && r.Method == http.MethodPost && parts[1] == "rates":
+		h.scheduleRates(w, r, parts[0])
+	case rest == "" || len(parts) == 1 || len(parts) == 2 && isProgramAction(parts[1]):
+		writeErrorResponse(w, "Method not supported", http.StatusMethodNotAllowed)
+	default:
+		writeErrorResponse(w, "not found", http.StatusNotFound)
+	}
+}
+
+// authorized compares the bearer token in constant time, the API is closed without a token
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || h.token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func (h *AdminHandler) create(w http.ResponseWriter, r *http.Request) {
+	var definition model.ProgramDefinition
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxProgramSize)).Decode(&definition); err != nil {
+		writeErrorResponse(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// New programs are offered right away
+	definition.Active = true
+
+	catalog, err := h.admin.CreateProgram(definition)
+	h.writeChange(w, catalog, definition.Code, err, http.StatusCreated)
+}
+
+func (h *AdminHandler) get(w http.ResponseWriter, code string) {
+	catalog := h.admin.Catalog()
+	h.writeProgram(w, catalog, code, http.StatusOK)
+}
+
+func (h *AdminHandler) update(w http.ResponseWriter, r *http.Request, code string) {
+	var definition model.ProgramDefinition
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxProgramSize)).Decode(&definition); err != nil {
+		writeErrorResponse(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	catalog, err := h.admin.UpdateProgram(code, definition)
+	h.writeChange(w, catalog, code, err, http.StatusOK)
+}
+
+func (h *AdminHandler) setActive(w http.ResponseWriter, code string, active bool) {
+	catalog, err := h.admin.SetProgramActive(code, active)
+	h.writeChange(w, catalog, code, err, http.StatusOK)
+}
+
+func (h *AdminHandler) scheduleRates(w http.ResponseWriter, r *http.Request, code string) {
+	var period model.RatePeriod
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxProgramSize)).Decode(&period); err != nil {
+		writeErrorResponse(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	catalog, err := h.admin.ScheduleRates(code, period)
+	h.writeChange(w, catalog, code, err, http.StatusOK)
+}
+
+func isProgramAction(action string) bool {
+	return action == "activate" || action == "deactivate" || action == "rates"
+}
+
+func (h *AdminHandler) writeChange(w http.ResponseWriter, catalog model.Catalog, code string, err error, status int) {
+	if err != nil {
+		writeErrorResponse(w, adminErrorMessage(err), adminErrorStatus(err))
+		return
+	}
+
+	log.Printf("Program catalog version %d: program %s changed", catalog.Version, code)
+	h.writeProgram(w, catalog, code, status)
+}
+
+func (h *AdminHandler) writeProgram(w http.ResponseWriter, catalog model.Catalog, code string, status int) {
+	for _, program := range catalog.Programs {
+		if program.Code == code {
+			writeJSON(w, ProgramResponse{Result: ProgramResult{Version: catalog.Version, Program: program}}, status)
+			return
+		}
+	}
+
+	writeErrorResponse(w, "unknown mortgage program: "+code, http.StatusNotFound)
+}
+
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUnknownProgram):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrProgramExists):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrInvalidProgram):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func adminErrorMessage(err error) string {
+	if adminErrorStatus(err) == http.StatusInternalServerError {
+		log.Printf("Error changing program catalog: %v", err)
+		return "catalog change failed"
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/velvetriddles/mortgage-calc/internal/cache"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+const testAdminToken = "secret"
+
+func adminRequest(h *AdminHandler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// TestAdminHandler_Unauthorized tests requests without a valid token
+func TestAdminHandler_Unauthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+	}{
+		{name: "No header", token: testAdminToken},
+		{name: "Wrong token", token: testAdminToken, header: "Bearer wrong"},
+		{name: "Not a bearer token", token: testAdminToken, header: testAdminToken},
+		{name: "No token configured", header: "Bearer "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAdminHandler(service.NewMortCalculator(), tt.token)
+			req := httptest.NewRequest("GET", AdminProgramsPath, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+}
+
+// TestAdminHandler_Programs tests creating, updating and deactivating a program
+// and that calculations report the catalog version
+func TestAdminHandler_Programs(t *testing.T) {
+	calculator := service.NewMortCalculator()
+	h := NewAdminHandler(calculator, testAdminToken)
+
+	rr := adminRequest(h, "GET", AdminProgramsPath, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var list CatalogResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if list.Result.Version != 1 || len(list.Result.Programs) != len(service.DefaultPrograms) {
+		t.Fatalf("Expected version 1 with %d programs, got %+v", len(service.DefaultPrograms), list.Result)
+	}
+
+	program := `{"code": "promo", "name": "Promo", "tiers": [{"min_initial_payment": 15, "rate": 5.5}],
+		"modifiers": ["no_life_insurance"], "limits": {"min_months": 12, "max_months": 240}}`
+	rr = adminRequest(h, "POST", AdminProgramsPath, program)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var created ProgramResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if created.Result.Version != 2 || !created.Result.Program.Active {
+		t.Errorf("Expected an active program in version 2, got %+v", created.Result)
+	}
+
+	mortHandler := NewMortHandler(cache.NewMortCache(), calculator, nil)
+	execute := func() (int, SuccessResponse) {
+		body := `{"object_cost": 5000000, "initial_payment": 1000000, "months": 240, "program": "promo"}`
+		rr := httptest.NewRecorder()
+		mortHandler.Execute(rr, httptest.NewRequest("POST", "/execute", bytes.NewBufferString(body)))
+
+		var resp SuccessResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+
+		return rr.Code, resp
+	}
+
+	code, resp := execute()
+	if code != http.StatusOK {
+		t.Fatalf("Expected the new program to be calculated, got status code %d", code)
+	}
+	if resp.Result.Aggregates.CatalogVersion != 2 || resp.Result.Aggregates.Rate.String() != "5.5" {
+		t.Errorf("Expected rate 5.5 from catalog version 2, got %s from version %d",
+			resp.Result.Aggregates.Rate, resp.Result.Aggregates.CatalogVersion)
+	}
+
+	rr = adminRequest(h, "PUT", AdminProgramsPath+"/promo",
+		strings.Replace(program, `"rate": 5.5`, `"rate": 5.9`, 1))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	rr = adminRequest(h, "GET", AdminProgramsPath+"/promo", "")
+	var updated ProgramResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if updated.Result.Version != 3 || updated.Result.Program.Tiers[0].Rate.String() != "5.9" {
+		t.Errorf("Expected rate 5.9 in version 3, got %+v", updated.Result)
+	}
+
+	rr = adminRequest(h, "POST", AdminProgramsPath+"/promo/deactivate", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if code, _ := execute(); code != http.StatusBadRequest {
+		t.Errorf("Expected a deactivated program to be rejected, got status code %d", code)
+	}
+
+	rr = adminRequest(h, "POST", AdminProgramsPath+"/promo/activate", "")
+	var activated ProgramResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &activated); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if activated.Result.Version != 5 || !activated.Result.Program.Active {
+		t.Errorf("Expected an active program in version 5, got %+v", activated.Result)
+	}
+}
+
+// TestAdminHandler_Errors tests the status codes of rejected changes
+func TestAdminHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{
+			name:   "Duplicate code",
+			method: "POST",
+			path:   AdminProgramsPath,
+			body:   `{"code": "salary", "tiers": [{"min_initial_payment": 20, "rate": 8}]}`,
+			status: http.StatusConflict,
+		},
+		{
+			name:   "No tiers",
+			method: "POST",
+			path:   AdminProgramsPath,
+			body:   `{"code": "promo"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Unknown modifier",
+			method: "POST",
+			path:   AdminProgramsPath,
+			body:   `{"code": "promo", "tiers": [{"min_initial_payment": 20, "rate": 8}], "modifiers": ["vip"]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Duplicate modifier",
+			method: "PUT",
+			path:   AdminProgramsPath + "/salary",
+			body: `{"code": "salary", "tiers": [{"min_initial_payment": 20, "rate": 8}], "modifiers": ["no_life_insurance"` +
+				strings.Repeat(`, "no_life_insurance"`, 64) + `]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Invalid JSON",
+			method: "POST",
+			path:   AdminProgramsPath,
+			body:   `{`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Body too large",
+			method: "POST",
+			path:   AdminProgramsPath,
+			body:   `{"code": "` + strings.Repeat("a", maxProgramSize) + `"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Code change",
+			method: "PUT",
+			path:   AdminProgramsPath + "/salary",
+			body:   `{"code": "corporate", "tiers": [{"min_initial_payment": 20, "rate": 8}]}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Unknown program",
+			method: "POST",
+			path:   AdminProgramsPath + "/promo/deactivate",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Unknown action",
+			method: "POST",
+			path:   AdminProgramsPath + "/salary/delete",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Method not allowed",
+			method: "DELETE",
+			path:   AdminProgramsPath + "/salary",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calculator := service.NewMortCalculator()
+			rr := adminRequest(NewAdminHandler(calculator, testAdminToken), tt.method, tt.path, tt.body)
+
+			if rr.Code != tt.status {
+				t.Errorf("Expected status code %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if calculator.Catalog().Version != 1 {
+				t.Errorf("Expected the catalog to stay unchanged, got version %d", calculator.Catalog().Version)
+			}
+		})
+	}
+}
+
+// TestAdminHandler_ScheduleRates tests scheduling a rate change and replacing it
+func TestAdminHandler_ScheduleRates(t *testing.T) {
+	h := NewAdminHandler(service.NewMortCalculator(), testAdminToken)
+
+	for _, rate := range []string{"9", "9.5"} {
+		rr := adminRequest(h, "POST", AdminProgramsPath+"/salary/rates",
+			`{"effective_from": "2024-03-01", "tiers": [{"min_initial_payment": 20, "rate": `+rate+`}]}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := adminRequest(h, "GET", AdminProgramsPath+"/salary", "")
+	var resp ProgramResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	rates := resp.Result.Program.Rates
+	if len(rates) != 1 || rates[0].Tiers[0].Rate.String() != "9.5" {
+		t.Errorf("Expected one rate period at 9.5%%, got %+v", rates)
+	}
+
+	rr = adminRequest(h, "POST", AdminProgramsPath+"/salary/rates", `{"effective_from": "2024-04-01", "tiers": []}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a period without tiers, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+type BrandingResponse struct {
+	Result model.Branding `json:"result"`
+}
+
+type BrandingHandler struct {
+	branding model.Branding
+}
+
+// NewBrandingHandler creates the handler of the texts of a site,
+// tenant is empty for the site of no tenant
+func NewBrandingHandler(tenant string, texts map[string]string) *BrandingHandler {
+	if texts == nil {
+		texts = map[string]string{}
+	}
+
+	return &BrandingHandler{
+		branding: model.Branding{Tenant: tenant, Texts: texts},
+	}
+}
+
+// Get returns the texts the site shows around the calculator
+func (h *BrandingHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorResponse(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, BrandingResponse{Result: h.branding}, http.StatusOK)
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// TestBrandingHandler_Get tests a GET request to /branding
+func TestBrandingHandler_Get(t *testing.T) {
+	handler := NewBrandingHandler("partner", map[string]string{"title": "Partner mortgage"})
+
+	rr := httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest("GET", "/branding", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp BrandingResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	expected := model.Branding{Tenant: "partner", Texts: map[string]string{"title": "Partner mortgage"}}
+	if !reflect.DeepEqual(resp.Result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, resp.Result)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Get(rr, httptest.NewRequest("POST", "/branding", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/velvetriddles/mortgage-calc/internal/features"
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+type EligibilityResponse struct {
+	Result []model.EligibilityResult `json:"result"`
+}
+
+type EligibilityHandler struct {
+	checker service.EligibilityChecker
+}
+
+func NewEligibilityHandler(checker service.EligibilityChecker) *EligibilityHandler {
+	return &EligibilityHandler{
+		checker: checker,
+	}
+}
+
+// Check returns for every program whether the applicant qualifies and which conditions failed
+func (h *EligibilityHandler) Check(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req model.EligibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	req.Features = features.FromContext(r.Context())
+
+	writeJSON(w, EligibilityResponse{Result: h.checker.CheckEligibility(req.Applicant, req.Features)}, http.StatusOK)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// TestEligibilityHandler_Check tests a POST request to /eligibility
+func TestEligibilityHandler_Check(t *testing.T) {
+	handler := NewEligibilityHandler(service.NewMortCalculator())
+
+	reqJSON, err := json.Marshal(model.EligibilityRequest{
+		Applicant: model.Applicant{
+			Age:          30,
+			Region:       "kamchatka",
+			PropertyType: model.PropertyNewBuild,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error marshaling request: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/eligibility", bytes.NewBuffer(reqJSON))
+	rr := httptest.NewRecorder()
+
+	handler.Check(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var resp EligibilityResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	for _, result := range resp.Result {
+		if result.Program == "far_east" && !result.Eligible {
+			t.Errorf("Expected far_east to be eligible, got %+v", result.Checks)
+		}
+		if result.Program == "family" && result.Eligible {
+			t.Errorf("Expected family not to be eligible without children")
+		}
+	}
+}
+
+// TestEligibilityHandler_Method tests that only POST is accepted
+func TestEligibilityHandler_Method(t *testing.T) {
+	handler := NewEligibilityHandler(service.NewMortCalculator())
+
+	rr := httptest.NewRecorder()
+	handler.Check(rr, httptest.NewRequest("GET", "/eligibility", nil))
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status code %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+	}
+}
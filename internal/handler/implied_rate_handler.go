@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/velvetriddles/mortgage-calc/internal/features"
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+type ImpliedRateResponse struct {
+	Result model.ImpliedRateResult `json:"result"`
+}
+
+type ImpliedRateHandler struct {
+	solver   service.RateSolver
+	location *time.Location
+}
+
+// NewImpliedRateHandler creates the handler, location is the timezone of the
+// date our programs are priced on
+func NewImpliedRateHandler(solver service.RateSolver, location *time.Location) *ImpliedRateHandler {
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &ImpliedRateHandler{
+		solver:   solver,
+		location: location,
+	}
+}
+
+// Solve returns the annual rate implied by a competitor's quoted payment and
+// which of our programs beat it
+func (h *ImpliedRateHandler) Solve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req model.ImpliedRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	req.Features = features.FromContext(r.Context())
+
+	result, err := h.solver.ImpliedRate(req, time.Now().In(h.location))
+	if err != nil {
+		writeErrorResponse(w, getErrorMessage(err), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, ImpliedRateResponse{Result: result}, http.StatusOK)
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// TestImpliedRateHandler_Solve tests a POST request to /implied-rate
+func TestImpliedRateHandler_Solve(t *testing.T) {
+	handler := NewImpliedRateHandler(service.NewMortCalculator(), time.UTC)
+
+	reqJSON, err := json.Marshal(model.ImpliedRateRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		MonthlyPayment: decimal.NewFromInt(36000),
+	})
+	if err != nil {
+		t.Fatalf("Error marshaling request: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/implied-rate", bytes.NewBuffer(reqJSON))
+	rr := httptest.NewRecorder()
+
+	handler.Solve(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp ImpliedRateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if !resp.Result.ImpliedRate.Equal(decimal.RequireFromString("9.0043")) {
+		t.Errorf("Expected implied rate 9.0043, got %s", resp.Result.ImpliedRate)
+	}
+	if len(resp.Result.Offers) == 0 || resp.Result.Offers[0].Program != "salary" {
+		t.Errorf("Expected salary to be the best offer, got %+v", resp.Result.Offers)
+	}
+}
+
+// TestImpliedRateHandler_PaymentTooLow tests a quote that cannot repay the loan
+func TestImpliedRateHandler_PaymentTooLow(t *testing.T) {
+	handler := NewImpliedRateHandler(service.NewMortCalculator(), time.UTC)
+
+	reqJSON, _ := json.Marshal(model.ImpliedRateRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		MonthlyPayment: decimal.NewFromInt(10000),
+	})
+
+	rr := httptest.NewRecorder()
+	handler.Solve(rr, httptest.NewRequest("POST", "/implied-rate", bytes.NewBuffer(reqJSON)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -2,17 +2,22 @@ package handler
 
 import (
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/velvetriddles/mortgage-calc/internal/cache"
+	"github.com/velvetriddles/mortgage-calc/internal/features"
 	"github.com/velvetriddles/mortgage-calc/internal/model"
 	"github.com/velvetriddles/mortgage-calc/internal/service"
 )
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error   string       `json:"error"`
+	Details []string     `json:"details,omitempty"`
+	Trace   *model.Trace `json:"trace,omitempty"`
 }
 
 type SuccessResponse struct {
@@ -32,40 +37,35 @@ func writeErrorResponse(w http.ResponseWriter, message string, status int) {
 	writeJSON(w, ErrorResponse{Error: message}, status)
 }
 
+func writeText(w http.ResponseWriter, text string, status int) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+
+	if _, err := io.WriteString(w, text); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
 type MortHandler struct {
 	cache      *cache.MortCache
 	calculator service.Calculator
+	location   *time.Location
 }
 
-func NewMortHandler(cache *cache.MortCache, calculator service.Calculator) *MortHandler {
+// NewMortHandler creates the handler, location is the timezone used to
+// determine the contract date when the request does not specify one
+func NewMortHandler(cache *cache.MortCache, calculator service.Calculator, location *time.Location) *MortHandler {
+	if location == nil {
+		location = time.UTC
+	}
+
 	return &MortHandler{
 		cache:      cache,
 		calculator: calculator,
+		location:   location,
 	}
 }
 
-func validateProgramRequest(program model.ProgramRequest) error {
-	count := 0
-	if program.Salary {
-		count++
-	}
-	if program.Military {
-		count++
-	}
-	if program.Base {
-		count++
-	}
-
-	switch {
-	case count == 0:
-		return model.ErrChooseNone
-	case count > 1:
-		return model.ErrChooseMultiple
-	}
-
-	return nil
-}
-
 func getErrorMessage(err error) string {
 	switch err {
 	case model.ErrChooseNone:
@@ -92,15 +92,26 @@ func (h *MortHandler) Execute(w http.ResponseWriter, r *http.Request) {
 		writeErrorResponse(w, "invalid request", http.StatusBadRequest)
 		return
 	}
+	req.Features = features.FromContext(r.Context())
 
-	if err := validateProgramRequest(req.Program); err != nil {
+	if err := req.Program.Validate(); err != nil {
 		writeErrorResponse(w, getErrorMessage(err), http.StatusBadRequest)
 		return
 	}
 
-	agg, err := h.calculator.Calculate(req, time.Now())
+	query := r.URL.Query()
+	if explain, err := strconv.ParseBool(query.Get("explain")); err == nil && explain {
+		req.Explain = true
+	}
+	textFormat := query.Get("format") == "text"
+
+	agg, trace, err := h.calculate(req)
 	if err != nil {
-		writeErrorResponse(w, getErrorMessage(err), http.StatusBadRequest)
+		if textFormat && trace != nil {
+			writeText(w, getErrorMessage(err)+"\n"+trace.String(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, ErrorResponse{Error: getErrorMessage(err), Trace: trace}, http.StatusBadRequest)
 		return
 	}
 
@@ -112,12 +123,33 @@ func (h *MortHandler) Execute(w http.ResponseWriter, r *http.Request) {
 		},
 		Program:    req.Program,
 		Aggregates: agg,
+		Features:   req.Features,
 	}
 
+	// The trace is returned to the caller only and is not cached
 	h.cache.Save(resp)
+	resp.Trace = trace
+
+	if textFormat && trace != nil {
+		writeText(w, trace.String(), http.StatusOK)
+		return
+	}
+
 	writeJSON(w, SuccessResponse{Result: resp}, http.StatusOK)
 }
 
+// calculate runs the calculation, with the trace when the request asks to explain it
+func (h *MortHandler) calculate(req model.ExecuteRequest) (model.Aggregates, *model.Trace, error) {
+	baseTime := time.Now().In(h.location)
+
+	if explainer, ok := h.calculator.(service.Explainer); ok && req.Explain {
+		return explainer.Explain(req, baseTime)
+	}
+
+	agg, err := h.calculator.Calculate(req, baseTime)
+	return agg, nil, err
+}
+
 func (h *MortHandler) GetCache(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeErrorResponse(w, "Method not supported", http.StatusMethodNotAllowed)
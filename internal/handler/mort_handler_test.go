@@ -3,14 +3,17 @@ package handler
 import (
 	"bytes"
 	"encoding/json"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/shopspring/decimal"
 
 	"github.com/velvetriddles/mortgage-calc/internal/cache"
+	"github.com/velvetriddles/mortgage-calc/internal/features"
 	"github.com/velvetriddles/mortgage-calc/internal/model"
 	"github.com/velvetriddles/mortgage-calc/internal/service"
 )
@@ -20,16 +23,14 @@ func TestExecuteHandler_Success(t *testing.T) {
 	// Create test dependencies
 	mortCache := cache.NewMortCache()
 	calculator := service.NewMortCalculator()
-	handler := NewMortHandler(mortCache, calculator)
+	handler := NewMortHandler(mortCache, calculator, time.UTC)
 
 	// Create test request
 	reqBody := model.ExecuteRequest{
 		ObjectCost:     decimal.NewFromInt(5000000),
 		InitialPayment: decimal.NewFromInt(1000000),
 		Months:         240,
-		Program: model.ProgramRequest{
-			Salary: true,
-		},
+		Program:        model.ProgramRequest{Code: "salary"},
 	}
 
 	// Serialize request to JSON
@@ -77,27 +78,18 @@ func TestExecuteHandler_MultiplePrograms(t *testing.T) {
 	// Create test dependencies
 	mortCache := cache.NewMortCache()
 	calculator := service.NewMortCalculator()
-	handler := NewMortHandler(mortCache, calculator)
+	handler := NewMortHandler(mortCache, calculator, time.UTC)
 
-	// Create test request with two programs
-	reqBody := model.ExecuteRequest{
-		ObjectCost:     decimal.NewFromInt(5000000),
-		InitialPayment: decimal.NewFromInt(1000000),
-		Months:         240,
-		Program: model.ProgramRequest{
-			Salary:   true,
-			Military: true,
-		},
-	}
-
-	// Serialize request to JSON
-	reqJSON, err := json.Marshal(reqBody)
-	if err != nil {
-		t.Fatalf("Error marshaling request: %v", err)
-	}
+	// Create test request with two programs in the legacy object form
+	reqJSON := `{
+		"object_cost": 5000000,
+		"initial_payment": 1000000,
+		"months": 240,
+		"program": {"salary": true, "military": true}
+	}`
 
 	// Create HTTP request
-	req := httptest.NewRequest("POST", "/execute", bytes.NewBuffer(reqJSON))
+	req := httptest.NewRequest("POST", "/execute", strings.NewReader(reqJSON))
 	req.Header.Set("Content-Type", "application/json")
 
 	// Create ResponseRecorder to record the response
@@ -132,7 +124,7 @@ func TestGetCacheHandler_EmptyCache(t *testing.T) {
 	// Create a mock calculator implementing the Calculator interface
 	mockCalculator := &MockCalculator{}
 
-	handler := NewMortHandler(mortCache, mockCalculator)
+	handler := NewMortHandler(mortCache, mockCalculator, time.UTC)
 
 	// Create HTTP request
 	req := httptest.NewRequest("GET", "/cache", nil)
@@ -169,3 +161,143 @@ func (m *MockCalculator) Calculate(req model.ExecuteRequest, baseTime time.Time)
 	// Just return an empty structure for the test
 	return model.Aggregates{}, nil
 }
+
+// TestExecuteHandler_Explain tests the calculation trace in JSON and text formats
+func TestExecuteHandler_Explain(t *testing.T) {
+	mortCache := cache.NewMortCache()
+	handler := NewMortHandler(mortCache, service.NewMortCalculator(), time.UTC)
+
+	reqJSON, err := json.Marshal(model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+	})
+	if err != nil {
+		t.Fatalf("Error marshaling request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.Execute(rr, httptest.NewRequest("POST", "/execute?explain=true", bytes.NewBuffer(reqJSON)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var resp SuccessResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if resp.Result.Trace == nil || len(resp.Result.Trace.Steps) == 0 {
+		t.Fatal("Expected the calculation trace in the response")
+	}
+
+	// The trace is not stored in the cache
+	items, err := mortCache.GetAll()
+	if err != nil || items[0].Trace != nil {
+		t.Errorf("Expected cached item without trace, got %v (%v)", items, err)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.Execute(rr, httptest.NewRequest("POST", "/execute?explain=true&format=text", bytes.NewBuffer(reqJSON)))
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Expected text response, got %s", contentType)
+	}
+
+	if !bytes.Contains(rr.Body.Bytes(), []byte("rounded payment = rounded half away from zero to whole rubles = 33458")) {
+		t.Errorf("Expected rounded payment in the text trace, got:\n%s", rr.Body.String())
+	}
+}
+
+// TestExecuteHandler_ProgramForms tests that the program is accepted both as a code and as the legacy object
+func TestExecuteHandler_ProgramForms(t *testing.T) {
+	handler := NewMortHandler(cache.NewMortCache(), service.NewMortCalculator(), time.UTC)
+
+	tests := []struct {
+		name           string
+		program        string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "Code", program: `"salary"`, expectedStatus: http.StatusOK},
+		{name: "Legacy object", program: `{"salary": true, "base": false}`, expectedStatus: http.StatusOK},
+		{name: "Empty code", program: `""`, expectedStatus: http.StatusBadRequest, expectedError: "choose program"},
+		{name: "Unknown code", program: `"gold"`, expectedStatus: http.StatusBadRequest, expectedError: "unknown mortgage program: gold"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"object_cost": 5000000, "initial_payment": 1000000, "months": 240, "program": ` + tt.program + `}`
+
+			rr := httptest.NewRecorder()
+			handler.Execute(rr, httptest.NewRequest("POST", "/execute", strings.NewReader(body)))
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status code %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				var resp ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("Error decoding response: %v", err)
+				}
+				if resp.Error != tt.expectedError {
+					t.Errorf("Expected error '%s', got '%s'", tt.expectedError, resp.Error)
+				}
+				return
+			}
+
+			// Responses keep the legacy object form for existing clients
+			var resp struct {
+				Result struct {
+					Program map[string]bool `json:"program"`
+				} `json:"result"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Error decoding response: %v", err)
+			}
+			expected := map[string]bool{"salary": true, "military": false, "base": false}
+			if !maps.Equal(resp.Result.Program, expected) {
+				t.Errorf("Expected program %v, got %v", expected, resp.Result.Program)
+			}
+			if !strings.Contains(rr.Body.String(), `"program":{"salary":true,"military":false,"base":false}`) {
+				t.Errorf("Expected the legacy flags in their original order, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+// TestExecuteHandler_Features tests that the response lists the features of the request
+func TestExecuteHandler_Features(t *testing.T) {
+	flags, err := features.NewFlags([]features.Flag{{Name: service.FeatureBankersRounding, Percentage: 100}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	handler := flags.Handler(http.HandlerFunc(NewMortHandler(cache.NewMortCache(), service.NewMortCalculator(), time.UTC).Execute))
+
+	reqJSON, _ := json.Marshal(model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+	})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/execute", bytes.NewBuffer(reqJSON)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp SuccessResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+	if len(resp.Result.Features) != 1 || resp.Result.Features[0] != service.FeatureBankersRounding {
+		t.Errorf("Expected features [%s], got %v", service.FeatureBankersRounding, resp.Result.Features)
+	}
+	if header := rr.Header().Get(features.Header); header != service.FeatureBankersRounding {
+		t.Errorf("Expected header %s: %s, got %q", features.Header, service.FeatureBankersRounding, header)
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/velvetriddles/mortgage-calc/internal/features"
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+type OffersResponse struct {
+	Result model.OffersResult `json:"result"`
+}
+
+type OffersHandler struct {
+	aggregator service.OfferAggregator
+	location   *time.Location
+}
+
+// NewOffersHandler creates the handler, location is the timezone of the
+// date the programs are priced on
+func NewOffersHandler(aggregator service.OfferAggregator, location *time.Location) *OffersHandler {
+	if location == nil {
+		location = time.UTC
+	}
+
+	return &OffersHandler{
+		aggregator: aggregator,
+		location:   location,
+	}
+}
+
+// Compare returns the offers of all lenders for the loan, best first
+func (h *OffersHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req model.OffersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorResponse(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	req.Features = features.FromContext(r.Context())
+
+	result, err := h.aggregator.Offers(req, time.Now().In(h.location))
+	if err != nil {
+		writeErrorResponse(w, getErrorMessage(err), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, OffersResponse{Result: result}, http.StatusOK)
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// TestOffersHandler_Compare tests a POST request to /offers
+func TestOffersHandler_Compare(t *testing.T) {
+	handler := NewOffersHandler(service.NewMortCalculator(), time.UTC)
+
+	body := `{"object_cost": 5000000, "initial_payment": 1000000, "months": 240, "sort_by": "overpayment"}`
+	rr := httptest.NewRecorder()
+	handler.Compare(rr, httptest.NewRequest("POST", "/offers", bytes.NewBufferString(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp OffersResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if resp.Result.SortBy != model.SortByOverpayment {
+		t.Errorf("Expected sort by %s, got %s", model.SortByOverpayment, resp.Result.SortBy)
+	}
+	if len(resp.Result.Offers) == 0 || resp.Result.Offers[0].Program != "salary" {
+		t.Errorf("Expected salary to be the best offer, got %+v", resp.Result.Offers)
+	}
+}
+
+// TestOffersHandler_Errors tests invalid requests to /offers
+func TestOffersHandler_Errors(t *testing.T) {
+	handler := NewOffersHandler(service.NewMortCalculator(), time.UTC)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{name: "Wrong method", method: "GET", status: http.StatusMethodNotAllowed},
+		{name: "Invalid JSON", method: "POST", body: `{`, status: http.StatusBadRequest},
+		{
+			name:   "Unknown sort order",
+			method: "POST",
+			body:   `{"object_cost": 5000000, "initial_payment": 1000000, "months": 240, "sort_by": "rate"}`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.Compare(rr, httptest.NewRequest(tt.method, "/offers", bytes.NewBufferString(tt.body)))
+
+			if rr.Code != tt.status {
+				t.Errorf("Expected status code %d, got %d", tt.status, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/scenario"
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// maxScenarioSize limits the size of an uploaded scenario file
+const maxScenarioSize = 1 << 20
+
+type ScenarioResponse struct {
+	Result model.ScenarioResult `json:"result"`
+}
+
+type ScenarioHandler struct {
+	evaluator service.ScenarioEvaluator
+}
+
+func NewScenarioHandler(evaluator service.ScenarioEvaluator) *ScenarioHandler {
+	return &ScenarioHandler{
+		evaluator: evaluator,
+	}
+}
+
+// Evaluate replays the YAML scenario in the request body and returns its full schedule.
+// Validation errors of the file are listed in the details with their line numbers.
+func (h *ScenarioHandler) Evaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorResponse(w, "Method not supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxScenarioSize))
+	if err != nil {
+		writeErrorResponse(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	s, err := scenario.Parse(data)
+	if err != nil {
+		var parseErrs scenario.Errors
+		if errors.As(err, &parseErrs) {
+			details := make([]string, len(parseErrs))
+			for i, e := range parseErrs {
+				details[i] = e.Error()
+			}
+			writeJSON(w, ErrorResponse{Error: "invalid scenario", Details: details}, http.StatusBadRequest)
+			return
+		}
+
+		writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.evaluator.Evaluate(s)
+	if err != nil {
+		writeErrorResponse(w, getErrorMessage(err), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, ScenarioResponse{Result: result}, http.StatusOK)
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/velvetriddles/mortgage-calc/internal/service"
+)
+
+// TestScenarioHandler_Evaluate tests a POST request to /scenario
+func TestScenarioHandler_Evaluate(t *testing.T) {
+	handler := NewScenarioHandler(service.NewMortCalculator())
+
+	body := `version: 1
+loan:
+  object_cost: 5000000
+  initial_payment: 1000000
+  months: 120
+  program: base
+  start_date: 2024-03-01
+events:
+  - date: 2025-01-01
+    type: rate_change
+    rate: 12
+`
+
+	rr := httptest.NewRecorder()
+	handler.Evaluate(rr, httptest.NewRequest("POST", "/scenario", strings.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp ScenarioResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	if resp.Result.Payments != 120 || resp.Result.LastPaymentDate != "2034-03-01" {
+		t.Errorf("Expected 120 payments until 2034-03-01, got %d until %s", resp.Result.Payments, resp.Result.LastPaymentDate)
+	}
+	if events := resp.Result.Schedule[9].Events; len(events) != 1 || events[0] != "rate_change" {
+		t.Errorf("Expected the rate change at the 10th payment, got %v", events)
+	}
+}
+
+// TestScenarioHandler_InvalidScenario tests that validation errors are listed with their lines
+func TestScenarioHandler_InvalidScenario(t *testing.T) {
+	handler := NewScenarioHandler(service.NewMortCalculator())
+
+	body := "version: 1\nloan:\n  object_cost: 5000000\n  months: many\n  program: base\n  start_date: 2024-03-01\n"
+
+	rr := httptest.NewRecorder()
+	handler.Evaluate(rr, httptest.NewRequest("POST", "/scenario", strings.NewReader(body)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error decoding response: %v", err)
+	}
+
+	expected := `line 4, column 11: loan.months: expected an integer, got "many"`
+	if len(resp.Details) != 1 || resp.Details[0] != expected {
+		t.Errorf("Expected details [%s], got %v", expected, resp.Details)
+	}
+}
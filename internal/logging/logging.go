@@ -0,0 +1,47 @@
+// Package logging defines the levels and formats of the request log, shared
+// by the configuration that validates them and the logger that applies them.
+package logging
+
+import "fmt"
+
+// Levels of the request log
+const (
+	// LevelInfo logs every request
+	LevelInfo = "info"
+	// LevelError logs failed requests only
+	LevelError = "error"
+)
+
+// Formats of the request log lines
+const (
+	// FormatText logs a line of key: value pairs
+	FormatText = "text"
+	// FormatJSON logs a JSON object per line
+	FormatJSON = "json"
+)
+
+// ParseLevel reports whether the level logs failed requests only,
+// an empty level is info
+func ParseLevel(level string) (errorsOnly bool, err error) {
+	switch level {
+	case "", LevelInfo:
+		return false, nil
+	case LevelError:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown log level %q, expected %q or %q", level, LevelInfo, LevelError)
+	}
+}
+
+// ParseFormat reports whether the format logs JSON objects,
+// an empty format is text
+func ParseFormat(format string) (asJSON bool, err error) {
+	switch format {
+	case "", FormatText:
+		return false, nil
+	case FormatJSON:
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown log format %q, expected %q or %q", format, FormatText, FormatJSON)
+	}
+}
@@ -1,12 +1,60 @@
 package middleware
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"sync/atomic"
 	"time"
+
+	"github.com/velvetriddles/mortgage-calc/internal/logging"
 )
 
-func Logger(next http.Handler) http.Handler {
+// RequestLogger logs requests at a level and in a format that can be changed while serving
+type RequestLogger struct {
+	errorsOnly atomic.Bool
+	asJSON     atomic.Bool
+}
+
+// NewRequestLogger creates a logger with the given level and format,
+// info and text when empty
+func NewRequestLogger(level, format string) (*RequestLogger, error) {
+	l := &RequestLogger{}
+	if err := l.SetLevel(level); err != nil {
+		return nil, err
+	}
+	if err := l.SetFormat(format); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// SetLevel changes the level of the requests logged from now on
+func (l *RequestLogger) SetLevel(level string) error {
+	errorsOnly, err := logging.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.errorsOnly.Store(errorsOnly)
+
+	return nil
+}
+
+// SetFormat changes the format of the requests logged from now on
+func (l *RequestLogger) SetFormat(format string) error {
+	asJSON, err := logging.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	l.asJSON.Store(asJSON)
+
+	return nil
+}
+
+// Handler logs the requests served by next
+func (l *RequestLogger) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -17,13 +65,39 @@ func Logger(next http.Handler) http.Handler {
 
 		next.ServeHTTP(rw, r)
 
+		if l.errorsOnly.Load() && rw.statusCode < http.StatusBadRequest {
+			return
+		}
+
 		duration := time.Since(start)
+		if l.asJSON.Load() {
+			logJSON(start, rw.statusCode, duration)
+			return
+		}
+
 		log.Printf("status_code: %d, duration: %d ns",
 			rw.statusCode,
 			duration.Nanoseconds())
 	})
 }
 
+// logJSON writes the request as a JSON object without the log prefix,
+// so that every line parses on its own
+func logJSON(start time.Time, statusCode int, duration time.Duration) {
+	line, _ := json.Marshal(struct {
+		Time       string `json:"time"`
+		StatusCode int    `json:"status_code"`
+		DurationNs int64  `json:"duration_ns"`
+	}{start.Format(time.RFC3339Nano), statusCode, duration.Nanoseconds()})
+
+	fmt.Fprintln(log.Writer(), string(line))
+}
+
+// Logger logs every request served by next
+func Logger(next http.Handler) http.Handler {
+	return (&RequestLogger{}).Handler(next)
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/velvetriddles/mortgage-calc/internal/logging"
+)
+
+// status answers with the given status code
+func status(code int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	})
+}
+
+// captureLog returns the log lines written by f
+func captureLog(t *testing.T, f func()) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+	}()
+
+	f()
+
+	return buf.String()
+}
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		name   string
+		level  string
+		format string
+		status int
+		// expected is the logged format, empty when the request is not logged
+		expected string
+	}{
+		{name: "Info logs success", level: logging.LevelInfo, format: logging.FormatText, status: http.StatusOK, expected: "text"},
+		{name: "Info logs failure", level: logging.LevelInfo, format: logging.FormatText, status: http.StatusBadRequest, expected: "text"},
+		{name: "Error skips success", level: logging.LevelError, format: logging.FormatText, status: http.StatusOK},
+		{name: "Error skips redirect", level: logging.LevelError, format: logging.FormatJSON, status: http.StatusFound},
+		{name: "Error logs client error", level: logging.LevelError, format: logging.FormatText, status: http.StatusNotFound, expected: "text"},
+		{name: "Error logs server error", level: logging.LevelError, format: logging.FormatJSON, status: http.StatusInternalServerError, expected: "json"},
+		{name: "JSON", level: logging.LevelInfo, format: logging.FormatJSON, status: http.StatusOK, expected: "json"},
+		{name: "Defaults", status: http.StatusOK, expected: "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The level and format are switched on a logger created with others
+			l, err := NewRequestLogger(logging.LevelError, logging.FormatJSON)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err = l.SetLevel(tt.level); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err = l.SetFormat(tt.format); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			output := captureLog(t, func() {
+				l.Handler(status(tt.status)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			})
+
+			switch tt.expected {
+			case "":
+				if output != "" {
+					t.Errorf("Expected the request not to be logged, got %q", output)
+				}
+			case "json":
+				var line struct {
+					StatusCode int `json:"status_code"`
+				}
+				if err := json.Unmarshal([]byte(output), &line); err != nil || line.StatusCode != tt.status {
+					t.Errorf("Expected a JSON line with status %d, got %q", tt.status, output)
+				}
+			case "text":
+				if !strings.HasPrefix(output, fmt.Sprintf("status_code: %d, duration: ", tt.status)) {
+					t.Errorf("Expected a text line with status %d, got %q", tt.status, output)
+				}
+			}
+		})
+	}
+}
+
+// TestRequestLogger_Invalid checks that an unknown level or format is rejected
+// and leaves the previous one in effect
+func TestRequestLogger_Invalid(t *testing.T) {
+	if _, err := NewRequestLogger("debug", logging.FormatText); err == nil {
+		t.Errorf("Expected an error for an unknown level")
+	}
+	if _, err := NewRequestLogger(logging.LevelInfo, "xml"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+
+	l, err := NewRequestLogger(logging.LevelError, logging.FormatText)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = l.SetLevel("debug"); err == nil || !strings.Contains(err.Error(), `unknown log level "debug"`) {
+		t.Errorf("Expected an unknown level error, got %v", err)
+	}
+	if err = l.SetFormat("xml"); err == nil || !strings.Contains(err.Error(), `unknown log format "xml"`) {
+		t.Errorf("Expected an unknown format error, got %v", err)
+	}
+
+	output := captureLog(t, func() {
+		l.Handler(status(http.StatusOK)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		l.Handler(status(http.StatusBadGateway)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+	if !strings.HasPrefix(output, fmt.Sprintf("status_code: %d, duration: ", http.StatusBadGateway)) || strings.Count(output, "\n") != 1 {
+		t.Errorf("Expected only the failed request logged as text, got %q", output)
+	}
+}
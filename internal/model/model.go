@@ -1,7 +1,14 @@
 package model
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/shopspring/decimal"
 )
@@ -10,12 +17,270 @@ var (
 	ErrChooseNone        = errors.New("no mortgage program selected")
 	ErrChooseMultiple    = errors.New("multiple mortgage programs selected")
 	ErrInitialPaymentLow = errors.New("initial payment is too low")
+
+	ErrDisbursementInvalid = errors.New("disbursement schedule is invalid")
+	ErrDisbursementSum     = errors.New("disbursements must add up to the loan sum")
+
+	ErrHolidayTooLong = errors.New("payment holiday cannot exceed 6 months")
+	ErrHolidayInvalid = errors.New("payment holiday is outside the repayment period")
+
+	ErrPaymentDayInvalid    = errors.New("payment day must be between 1 and 31")
+	ErrFirstPaymentTooEarly = errors.New("first payment date must be after the contract date")
+
+	ErrUnknownModifier = errors.New("rate modifier is not available for the program")
+
+	ErrServicemanNotMilitary = errors.New("serviceman birth date is only accepted for the military program")
+	ErrServicemanTooOld      = errors.New("serviceman has reached the contribution age limit")
+
+	ErrApplicantRequired = errors.New("applicant data is required for the program")
+	ErrLimitViolated     = errors.New("program limit violated")
+
+	ErrFrequencyInvalid = errors.New("unknown payment frequency")
+	ErrTermFrequency    = errors.New("term must be a whole number of payment periods")
+	ErrMonthlyOnly      = errors.New("payment holidays and military contributions require monthly payments")
+
+	ErrCompoundingInvalid = errors.New("unknown compounding convention")
+	ErrAnnuityDueConflict = errors.New("annuity-due payments cannot be combined with tranches, holidays, military contributions or a first payment date")
+
+	ErrQuotedPaymentLow = errors.New("quoted payment does not cover the loan")
+
+	ErrSortInvalid = errors.New("unknown offer sort order")
+)
+
+// Compounding conventions of the annual rate
+const (
+	CompoundingMonthly    = "monthly"
+	CompoundingSemiAnnual = "semi_annual"
+	CompoundingAnnual     = "annual"
+)
+
+// Payment frequencies
+const (
+	FrequencyWeekly    = "weekly"
+	FrequencyBiweekly  = "biweekly"
+	FrequencyMonthly   = "monthly"
+	FrequencyQuarterly = "quarterly"
 )
 
+// LimitError reports a loan parameter outside the range allowed by the program.
+// A zero Max means the range has no upper bound.
+type LimitError struct {
+	Program string
+	Region  string
+	Limit   string
+	Unit    string
+	Value   decimal.Decimal
+	Min     decimal.Decimal
+	Max     decimal.Decimal
+}
+
+func (e *LimitError) Error() string {
+	scope := "the " + e.Program + " program"
+	if e.Region != "" {
+		scope += " in region " + e.Region
+	}
+
+	upper := "unlimited"
+	if e.Max.IsPositive() {
+		upper = e.Max.String()
+	}
+
+	return fmt.Sprintf("%s of %s %s violates the %s limit of %s: allowed %s..%s %s",
+		e.Limit, e.Value, e.Unit, e.Limit, scope, e.Min, upper, e.Unit)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitViolated
+}
+
+// NotEligibleError reports the program conditions the applicant does not meet
+type NotEligibleError struct {
+	Program string
+	Failed  []string
+}
+
+func (e *NotEligibleError) Error() string {
+	return fmt.Sprintf("client is not eligible for the %s program: %s", e.Program, strings.Join(e.Failed, "; "))
+}
+
+// DateLayout is the format of all calendar dates in requests and responses
+const DateLayout = "2006-01-02"
+
+// Date is a calendar date encoded in JSON as "YYYY-MM-DD"
+type Date struct {
+	time.Time
+}
+
+// NewDate truncates t to the calendar day in its own location
+func NewDate(t time.Time) Date {
+	return Date{Time: time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())}
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + d.Format(DateLayout) + `"`), nil
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid date %s, expected %q", data, DateLayout)
+	}
+
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected %q", s, DateLayout)
+	}
+
+	d.Time = t
+	return nil
+}
+
+// ProgramRequest selects a program of the catalog by its code. It is accepted
+// both as a string code ("salary") and as the legacy object with a flag per
+// program ({"salary": true}), and is written in the legacy form so that
+// existing clients keep reading responses: every legacy flag is written,
+// followed by the code of a newer program.
 type ProgramRequest struct {
-	Salary   bool `json:"salary"`
-	Military bool `json:"military"`
-	Base     bool `json:"base"`
+	Code string
+	// selected are the codes flagged in the legacy form
+	selected []string
+}
+
+// Validate checks that exactly one program is selected
+func (p ProgramRequest) Validate() error {
+	switch {
+	case len(p.selected) > 1:
+		return ErrChooseMultiple
+	case p.Code == "":
+		return ErrChooseNone
+	}
+
+	return nil
+}
+
+// legacyPrograms are the flags of the legacy object in their original order
+var legacyPrograms = []string{"salary", "military", "base"}
+
+func (p ProgramRequest) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, code := range legacyPrograms {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:%t", code, p.Code == code)
+	}
+
+	if p.Code != "" && !slices.Contains(legacyPrograms, p.Code) {
+		code, err := json.Marshal(p.Code)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(code)
+		buf.WriteString(":true")
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (p *ProgramRequest) UnmarshalJSON(data []byte) error {
+	var code string
+	if err := json.Unmarshal(data, &code); err == nil {
+		*p = ProgramRequest{Code: code}
+		return nil
+	}
+
+	var flags map[string]bool
+	if err := json.Unmarshal(data, &flags); err != nil {
+		return fmt.Errorf("program must be a code or an object of program flags: %w", err)
+	}
+
+	selected := make([]string, 0, 1)
+	for code, set := range flags {
+		if set {
+			selected = append(selected, code)
+		}
+	}
+	sort.Strings(selected)
+
+	*p = ProgramRequest{selected: selected}
+	if len(selected) == 1 {
+		p.Code = selected[0]
+	}
+
+	return nil
+}
+
+// Property types accepted by the programs
+const (
+	PropertyNewBuild  = "new_build"
+	PropertySecondary = "secondary"
+	PropertyHouse     = "house"
+)
+
+// Employment types of the applicant
+const (
+	EmploymentEmployed      = "employed"
+	EmploymentSelfEmployed  = "self_employed"
+	EmploymentBusinessOwner = "business_owner"
+)
+
+// Applicant holds the client attributes the program eligibility rules depend on
+type Applicant struct {
+	Age                int    `json:"age"`
+	ChildrenAges       []int  `json:"children_ages,omitempty"`
+	EmployerAccredited bool   `json:"employer_accredited"`
+	Region             string `json:"region"`
+	PropertyType       string `json:"property_type"`
+	Employment         string `json:"employment,omitempty"`
+	// ExperienceMonths is the length of service at the current job
+	ExperienceMonths int `json:"experience_months,omitempty"`
+}
+
+// EligibilityCheck is the outcome of a single program condition,
+// Reason explains a failed one
+type EligibilityCheck struct {
+	Rule      string `json:"rule,omitempty"`
+	Condition string `json:"condition"`
+	Passed    bool   `json:"passed"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// EligibilityRuleDefinition is a program condition written in the rule
+// expression language, Condition describes it to clients
+type EligibilityRuleDefinition struct {
+	Name       string `json:"name"`
+	Condition  string `json:"condition"`
+	Expression string `json:"expression"`
+}
+
+// EligibilityResult tells whether the applicant qualifies for a program and why
+type EligibilityResult struct {
+	Program  string             `json:"program"`
+	Eligible bool               `json:"eligible"`
+	Checks   []EligibilityCheck `json:"checks"`
+}
+
+type EligibilityRequest struct {
+	Applicant Applicant `json:"applicant"`
+	// Features enabled for the request, set by the server
+	Features Features `json:"-"`
+}
+
+// Features are the names of the feature flags enabled for a request
+type Features []string
+
+// Enabled reports whether the feature is enabled
+func (f Features) Enabled(name string) bool {
+	for _, feature := range f {
+		if feature == name {
+			return true
+		}
+	}
+
+	return false
 }
 
 type RequestParams struct {
@@ -24,23 +289,324 @@ type RequestParams struct {
 	Months         int             `json:"months"`
 }
 
+// Disbursement is a single construction-phase tranche of an off-plan loan.
+// Month is counted from the contract date, the first tranche is usually 0.
+type Disbursement struct {
+	Month  int             `json:"month"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// PaymentHoliday freezes regular payments for a number of months.
+// StartMonth is the number of the first frozen annuity payment, starting from 1.
+type PaymentHoliday struct {
+	StartMonth int `json:"start_month"`
+	Months     int `json:"months"`
+}
+
 type ExecuteRequest struct {
 	ObjectCost     decimal.Decimal `json:"object_cost"`
 	InitialPayment decimal.Decimal `json:"initial_payment"`
 	Months         int             `json:"months"`
 	Program        ProgramRequest  `json:"program"`
+	Disbursements  []Disbursement  `json:"disbursements,omitempty"`
+	Holiday        *PaymentHoliday `json:"holiday,omitempty"`
+
+	// ContractDate defaults to the current date in the service timezone.
+	// FirstPaymentDate defaults to one month after the contract date.
+	// PaymentDay anchors all regular payments to a day of month and is
+	// clamped to the last day of shorter months.
+	ContractDate     *Date `json:"contract_date,omitempty"`
+	FirstPaymentDate *Date `json:"first_payment_date,omitempty"`
+	PaymentDay       int   `json:"payment_day,omitempty"`
+
+	// Modifiers are codes of rate modifiers from the program catalogue
+	Modifiers []string `json:"modifiers,omitempty"`
+
+	// ServicemanBirthDate enables modelling of the state savings-accumulation
+	// contributions for the military program
+	ServicemanBirthDate *Date `json:"serviceman_birth_date,omitempty"`
+
+	// Applicant is required by the state-subsidized programs
+	Applicant *Applicant `json:"applicant,omitempty"`
+
+	// Region of the property for regional loan caps, defaults to the applicant region
+	Region string `json:"region,omitempty"`
+
+	// Frequency of regular payments, monthly by default
+	Frequency string `json:"frequency,omitempty"`
+
+	// Compounding of the annual rate, once per payment period by default.
+	// AnnuityDue moves every payment to the start of its period, so the first
+	// one is made at signing.
+	Compounding string `json:"compounding,omitempty"`
+	AnnuityDue  bool   `json:"annuity_due,omitempty"`
+
+	// AsOf reproduces a quote made on that day: the rates valid on the date
+	// are used and it replaces the current date as the default contract date
+	AsOf *Date `json:"as_of,omitempty"`
+
+	// Explain requests the trace of the calculation, same as ?explain=true
+	Explain bool `json:"explain,omitempty"`
+
+	// Features enabled for the request, set by the server
+	Features Features `json:"-"`
+}
+
+// RateTier is a loan-to-value pricing step of a program: Rate applies when
+// the initial payment is at least MinInitialPayment percent of the object cost
+type RateTier struct {
+	MinInitialPayment decimal.Decimal `json:"min_initial_payment"`
+	Rate              decimal.Decimal `json:"rate"`
+}
+
+// RatePeriod is a rate table of a program effective from a date until the next period
+type RatePeriod struct {
+	EffectiveFrom Date       `json:"effective_from"`
+	Tiers         []RateTier `json:"tiers"`
+}
+
+// RateModifier is a surcharge or discount added to the program rate
+type RateModifier struct {
+	Code        string          `json:"code"`
+	Description string          `json:"description"`
+	Delta       decimal.Decimal `json:"delta"`
 }
 
 type Aggregates struct {
+	// ProgramName is the display name of the program from the catalog
+	ProgramName string `json:"program_name,omitempty"`
+	// Lender is the bank offering the program, empty for our own programs
+	Lender string `json:"lender,omitempty"`
+	// CatalogVersion is the version of the program catalog the calculation used
+	CatalogVersion int `json:"catalog_version"`
+	// Rate is the final annual rate: BaseRate plus all applied Modifiers
 	Rate            decimal.Decimal `json:"rate"`
+	BaseRate        decimal.Decimal `json:"base_rate"`
+	Modifiers       []RateModifier  `json:"modifiers,omitempty"`
+	RateTier        RateTier        `json:"rate_tier"`
 	LoanSum         decimal.Decimal `json:"loan_sum"`
 	MonthlyPayment  decimal.Decimal `json:"monthly_payment"`
 	Overpayment     decimal.Decimal `json:"overpayment"`
 	LastPaymentDate string          `json:"last_payment_date"`
+
+	// AsOf is the date the rates were taken from, RateEffectiveFrom is the start
+	// of the rate period applied and is empty for the base rate table
+	AsOf              string `json:"as_of"`
+	RateEffectiveFrom string `json:"rate_effective_from,omitempty"`
+
+	// For non-monthly frequencies PeriodPayment is the regular payment,
+	// Payments is their number and MonthlyPayment is the monthly equivalent
+	Frequency     string           `json:"frequency,omitempty"`
+	Payments      int              `json:"payments,omitempty"`
+	PeriodPayment *decimal.Decimal `json:"period_payment,omitempty"`
+	// TermMonths is the term in which accelerated bi-weekly payments, half of
+	// the monthly payment every 14 days, repay the loan ahead of the requested one
+	TermMonths int `json:"term_months,omitempty"`
+
+	Compounding string `json:"compounding,omitempty"`
+	AnnuityDue  bool   `json:"annuity_due,omitempty"`
+
+	// ConstructionInterest is the interest paid on drawn tranches before the
+	// final disbursement. It is already included in Overpayment.
+	ConstructionInterest *decimal.Decimal `json:"construction_interest,omitempty"`
+
+	// HolidayDeferred is the amount moved to the end of the term by a payment
+	// holiday, HolidayCost is the part of it exceeding the frozen payments.
+	// HolidayCost is already included in Overpayment.
+	HolidayDeferred *decimal.Decimal `json:"holiday_deferred,omitempty"`
+	HolidayCost     *decimal.Decimal `json:"holiday_cost,omitempty"`
+
+	Military *MilitarySummary `json:"military,omitempty"`
+}
+
+// MilitaryYear shows the payments of the state and of the serviceman summed
+// over the payment dates of a calendar year
+type MilitaryYear struct {
+	Year         int             `json:"year"`
+	StatePayment decimal.Decimal `json:"state_payment"`
+	OwnPayment   decimal.Decimal `json:"own_payment"`
+}
+
+// MilitarySummary describes repayment of a military mortgage by the state
+// savings-accumulation contributions
+type MilitarySummary struct {
+	StateTotal decimal.Decimal `json:"state_total"`
+	OwnTotal   decimal.Decimal `json:"own_total"`
+	// ContributionsEndDate is the date the serviceman reaches the age limit
+	ContributionsEndDate string `json:"contributions_end_date"`
+	// PayoffDate is the date of the last payment under the contributions
+	PayoffDate string         `json:"payoff_date"`
+	Years      []MilitaryYear `json:"years"`
 }
 
 type ExecuteResponse struct {
 	Params     RequestParams  `json:"params"`
 	Program    ProgramRequest `json:"program"`
 	Aggregates Aggregates     `json:"aggregates"`
+	// Features are the feature flags the calculation was made with
+	Features Features `json:"features,omitempty"`
+	Trace    *Trace   `json:"trace,omitempty"`
+}
+
+// ImpliedRateRequest is a competitor's offer to solve the annual rate for
+type ImpliedRateRequest struct {
+	ObjectCost     decimal.Decimal `json:"object_cost"`
+	InitialPayment decimal.Decimal `json:"initial_payment"`
+	Months         int             `json:"months"`
+	MonthlyPayment decimal.Decimal `json:"monthly_payment"`
+	// Applicant enables comparison with the state-subsidized programs
+	Applicant *Applicant `json:"applicant,omitempty"`
+	// Features enabled for the request, set by the server
+	Features Features `json:"-"`
+}
+
+// ProgramOffer is one of our programs compared to the quoted payment
+type ProgramOffer struct {
+	Lender         string          `json:"lender,omitempty"`
+	Program        string          `json:"program"`
+	Rate           decimal.Decimal `json:"rate"`
+	MonthlyPayment decimal.Decimal `json:"monthly_payment"`
+	MonthlySaving  decimal.Decimal `json:"monthly_saving"`
+}
+
+// ImpliedRateResult is the annual rate implied by the quote and our programs
+// beating it, the biggest monthly saving first
+type ImpliedRateResult struct {
+	CatalogVersion int             `json:"catalog_version"`
+	ImpliedRate    decimal.Decimal `json:"implied_rate"`
+	Offers         []ProgramOffer  `json:"offers"`
+}
+
+// Sort orders of the lender offers
+const (
+	SortByMonthlyPayment = "monthly_payment"
+	SortByOverpayment    = "overpayment"
+	SortByFullCost       = "full_cost"
+)
+
+// OffersRequest is a loan to compare across the programs of all lenders
+type OffersRequest struct {
+	ObjectCost     decimal.Decimal `json:"object_cost"`
+	InitialPayment decimal.Decimal `json:"initial_payment"`
+	Months         int             `json:"months"`
+	// Applicant and Region enable the programs with eligibility rules and regional caps
+	Applicant *Applicant `json:"applicant,omitempty"`
+	Region    string     `json:"region,omitempty"`
+	// Lenders limits the comparison to the given lenders, all when empty
+	Lenders []string `json:"lenders,omitempty"`
+	// SortBy is monthly_payment (the default), overpayment or full_cost
+	SortBy string `json:"sort_by,omitempty"`
+	// Features enabled for the request, set by the server
+	Features Features `json:"-"`
+}
+
+// LenderOffer is a program of a lender priced for the requested loan
+type LenderOffer struct {
+	Lender         string          `json:"lender,omitempty"`
+	Program        string          `json:"program"`
+	ProgramName    string          `json:"program_name,omitempty"`
+	Rate           decimal.Decimal `json:"rate"`
+	MonthlyPayment decimal.Decimal `json:"monthly_payment"`
+	Overpayment    decimal.Decimal `json:"overpayment"`
+	IssueFee       decimal.Decimal `json:"issue_fee"`
+	// FullCost is everything paid above the loan sum: the overpayment and the fee.
+	// FullCostRate is the annual rate in percent at which the payments repay
+	// the loan sum net of the fee.
+	FullCost     decimal.Decimal `json:"full_cost"`
+	FullCostRate decimal.Decimal `json:"full_cost_rate"`
+}
+
+// RejectedOffer is a program the loan does not qualify for
+type RejectedOffer struct {
+	Lender  string `json:"lender,omitempty"`
+	Program string `json:"program"`
+	Reason  string `json:"reason"`
+}
+
+// OffersResult are the offers ranked by the requested order, best first
+type OffersResult struct {
+	CatalogVersion int             `json:"catalog_version"`
+	SortBy         string          `json:"sort_by"`
+	Offers         []LenderOffer   `json:"offers"`
+	Rejected       []RejectedOffer `json:"rejected,omitempty"`
+}
+
+// ScheduleRow is a single scheduled payment of a loan timeline
+type ScheduleRow struct {
+	Number int             `json:"number"`
+	Date   string          `json:"date"`
+	Rate   decimal.Decimal `json:"rate"`
+	// Payment is the regular payment made, zero during a payment holiday
+	Payment    decimal.Decimal `json:"payment"`
+	Interest   decimal.Decimal `json:"interest"`
+	Principal  decimal.Decimal `json:"principal"`
+	Prepayment decimal.Decimal `json:"prepayment"`
+	Balance    decimal.Decimal `json:"balance"`
+	// Deferred is the amount frozen by payment holidays, paid after the balance
+	Deferred decimal.Decimal `json:"deferred"`
+	// Events are the types of scenario events applied from this payment
+	Events []string `json:"events,omitempty"`
+}
+
+// ScenarioResult is the full schedule of a loan timeline
+type ScenarioResult struct {
+	Name            string          `json:"name,omitempty"`
+	CatalogVersion  int             `json:"catalog_version"`
+	Program         string          `json:"program"`
+	LoanSum         decimal.Decimal `json:"loan_sum"`
+	MonthlyPayment  decimal.Decimal `json:"monthly_payment"`
+	TotalPaid       decimal.Decimal `json:"total_paid"`
+	Overpayment     decimal.Decimal `json:"overpayment"`
+	Payments        int             `json:"payments"`
+	LastPaymentDate string          `json:"last_payment_date"`
+	Schedule        []ScheduleRow   `json:"schedule"`
+}
+
+// ProgramLimits are the loan limits of a program, zero values mean no limit
+type ProgramLimits struct {
+	MinLoan   decimal.Decimal `json:"min_loan"`
+	MaxLoan   decimal.Decimal `json:"max_loan"`
+	MinMonths int             `json:"min_months"`
+	MaxMonths int             `json:"max_months"`
+	// Regions maps a region code to its loan cap
+	Regions map[string]decimal.Decimal `json:"regions,omitempty"`
+}
+
+// ProgramDefinition describes a catalog program in the admin API and the catalog file
+type ProgramDefinition struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	// Lender is the bank offering the program, empty for our own programs
+	Lender string `json:"lender,omitempty"`
+	// IssueFee is a one-time fee paid at signing, percent of the loan sum
+	IssueFee decimal.Decimal `json:"issue_fee"`
+	// Feature is the feature flag the program is rolled out with,
+	// the program is offered to the requests with the flag only
+	Feature string `json:"feature,omitempty"`
+	// Active is false for deactivated programs, which are kept but not offered
+	Active bool       `json:"active"`
+	Tiers  []RateTier `json:"tiers"`
+	// Rates are rate tables replacing Tiers from their effective dates
+	Rates []RatePeriod `json:"rates,omitempty"`
+	// Modifiers are codes from the rate modifier catalogue
+	Modifiers []string `json:"modifiers,omitempty"`
+	// Eligibility are names of the built-in eligibility rules
+	Eligibility []string `json:"eligibility,omitempty"`
+	// Rules are the program's own eligibility rules
+	Rules  []EligibilityRuleDefinition `json:"rules,omitempty"`
+	Limits ProgramLimits               `json:"limits"`
+}
+
+// Catalog is a version of the program catalog
+type Catalog struct {
+	Version   int                 `json:"version"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Programs  []ProgramDefinition `json:"programs"`
+}
+
+// Branding are the texts of the site a request was made for,
+// Tenant is empty for the site served to requests of no tenant
+type Branding struct {
+	Tenant string            `json:"tenant,omitempty"`
+	Texts  map[string]string `json:"texts"`
 }
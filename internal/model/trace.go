@@ -0,0 +1,75 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TraceStep is a single intermediate value of a calculation
+type TraceStep struct {
+	Name    string `json:"name"`
+	Formula string `json:"formula,omitempty"`
+	Value   string `json:"value"`
+}
+
+// TraceCheck is a validation check with the threshold it was compared against
+type TraceCheck struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	Threshold string `json:"threshold"`
+	Passed    bool   `json:"passed"`
+}
+
+// Trace explains how a calculation result was derived.
+// All methods are safe to call on a nil trace, which records nothing.
+type Trace struct {
+	Steps  []TraceStep  `json:"steps"`
+	Checks []TraceCheck `json:"checks"`
+}
+
+// Step records an intermediate value
+func (t *Trace) Step(name, formula string, value any) {
+	if t == nil {
+		return
+	}
+
+	t.Steps = append(t.Steps, TraceStep{Name: name, Formula: formula, Value: fmt.Sprint(value)})
+}
+
+// Check records a validation check
+func (t *Trace) Check(name string, value any, threshold string, passed bool) {
+	if t == nil {
+		return
+	}
+
+	t.Checks = append(t.Checks, TraceCheck{Name: name, Value: fmt.Sprint(value), Threshold: threshold, Passed: passed})
+}
+
+// String renders the trace as human-readable text
+func (t *Trace) String() string {
+	if t == nil {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteString("Checks:\n")
+	for _, c := range t.Checks {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "  [%s] %s: %s (allowed %s)\n", status, c.Name, c.Value, c.Threshold)
+	}
+
+	b.WriteString("Steps:\n")
+	for _, s := range t.Steps {
+		if s.Formula != "" {
+			fmt.Fprintf(&b, "  %s = %s = %s\n", s.Name, s.Formula, s.Value)
+			continue
+		}
+		fmt.Fprintf(&b, "  %s = %s\n", s.Name, s.Value)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenLeftBracket
+	tokenRightBracket
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	// text is the identifier, the operator or the unquoted string
+	text   string
+	number float64
+	// pos is the byte offset of the token in the expression
+	pos int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// tokenize splits the expression into tokens, the last one is always tokenEOF
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for pos := 0; pos < len(expression); {
+		c := expression[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: pos})
+			pos++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: pos})
+			pos++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokenLeftBracket, text: "[", pos: pos})
+			pos++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokenRightBracket, text: "]", pos: pos})
+			pos++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: pos})
+			pos++
+		case strings.ContainsRune("=!<>", rune(c)):
+			op := string(c)
+			if pos+1 < len(expression) && expression[pos+1] == '=' {
+				op += "="
+			}
+			if op == "=" || op == "!" {
+				return nil, &Error{Pos: pos, Message: fmt.Sprintf("unknown operator %q, expected == or !=", op)}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: pos})
+			pos += len(op)
+		case c == '"':
+			end := strings.IndexByte(expression[pos+1:], '"')
+			if end < 0 {
+				return nil, &Error{Pos: pos, Message: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: expression[pos+1 : pos+1+end], pos: pos})
+			pos += end + 2
+		case c == '-' || c == '.' || unicode.IsDigit(rune(c)):
+			end := pos + 1
+			for end < len(expression) && (expression[end] == '.' || unicode.IsDigit(rune(expression[end]))) {
+				end++
+			}
+			number, err := strconv.ParseFloat(expression[pos:end], 64)
+			if err != nil {
+				return nil, &Error{Pos: pos, Message: fmt.Sprintf("invalid number %q", expression[pos:end])}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: expression[pos:end], number: number, pos: pos})
+			pos = end
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := pos + 1
+			for end < len(expression) && (expression[end] == '_' || unicode.IsLetter(rune(expression[end])) ||
+				unicode.IsDigit(rune(expression[end]))) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expression[pos:end], pos: pos})
+			pos = end
+		default:
+			return nil, &Error{Pos: pos, Message: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(expression)}), nil
+}
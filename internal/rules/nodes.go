@@ -0,0 +1,271 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condition is a node evaluating to true or false, failed conditions
+// return the reasons
+type condition interface {
+	eval(attributes Attributes) (bool, []string)
+	String() string
+}
+
+// operand is a node evaluating to a value: float64, string, bool or []float64
+type operand interface {
+	value(attributes Attributes) any
+	typ() Type
+	String() string
+}
+
+type orCondition struct {
+	left, right condition
+}
+
+func (c *orCondition) eval(attributes Attributes) (bool, []string) {
+	left, leftReasons := c.left.eval(attributes)
+	if left {
+		return true, nil
+	}
+	right, rightReasons := c.right.eval(attributes)
+	if right {
+		return true, nil
+	}
+
+	return false, append(leftReasons, rightReasons...)
+}
+
+func (c *orCondition) String() string {
+	return c.left.String() + " or " + c.right.String()
+}
+
+type andCondition struct {
+	left, right condition
+}
+
+func (c *andCondition) eval(attributes Attributes) (bool, []string) {
+	left, leftReasons := c.left.eval(attributes)
+	right, rightReasons := c.right.eval(attributes)
+
+	return left && right, append(leftReasons, rightReasons...)
+}
+
+func (c *andCondition) String() string {
+	return c.left.String() + " and " + c.right.String()
+}
+
+type notCondition struct {
+	inner condition
+}
+
+func (c *notCondition) eval(attributes Attributes) (bool, []string) {
+	if passed, _ := c.inner.eval(attributes); passed {
+		return false, []string{fmt.Sprintf("expected not %s", c.inner)}
+	}
+
+	return true, nil
+}
+
+func (c *notCondition) String() string {
+	return "not " + c.inner.String()
+}
+
+type groupCondition struct {
+	inner condition
+}
+
+func (c *groupCondition) eval(attributes Attributes) (bool, []string) {
+	return c.inner.eval(attributes)
+}
+
+func (c *groupCondition) String() string {
+	return "(" + c.inner.String() + ")"
+}
+
+type comparison struct {
+	op          string
+	left, right operand
+}
+
+func (c *comparison) eval(attributes Attributes) (bool, []string) {
+	left, right := c.left.value(attributes), c.right.value(attributes)
+	if compare(c.op, left, right) {
+		return true, nil
+	}
+
+	return false, []string{fmt.Sprintf("%s is %s, expected %s %s", c.left, format(left), c.op, format(right))}
+}
+
+func (c *comparison) String() string {
+	return c.left.String() + " " + c.op + " " + c.right.String()
+}
+
+type membership struct {
+	value operand
+	list  []operand
+}
+
+func (c *membership) eval(attributes Attributes) (bool, []string) {
+	value := c.value.value(attributes)
+	for _, item := range c.list {
+		if compare("==", value, item.value(attributes)) {
+			return true, nil
+		}
+	}
+
+	return false, []string{fmt.Sprintf("%s is %s, expected one of %s", c.value, format(value), c.listString())}
+}
+
+func (c *membership) listString() string {
+	items := make([]string, len(c.list))
+	for i, item := range c.list {
+		items[i] = item.String()
+	}
+
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func (c *membership) String() string {
+	return c.value.String() + " in " + c.listString()
+}
+
+// truth is a boolean operand used as a condition
+type truth struct {
+	value operand
+}
+
+func (c *truth) eval(attributes Attributes) (bool, []string) {
+	if c.value.value(attributes).(bool) {
+		return true, nil
+	}
+
+	return false, []string{fmt.Sprintf("%s is false", c.value)}
+}
+
+func (c *truth) String() string {
+	return c.value.String()
+}
+
+type literal struct {
+	val  any
+	kind Type
+	text string
+}
+
+func (l *literal) value(Attributes) any { return l.val }
+func (l *literal) typ() Type            { return l.kind }
+func (l *literal) String() string       { return l.text }
+
+type attribute struct {
+	name string
+	kind Type
+}
+
+func (a *attribute) value(attributes Attributes) any {
+	return normalize(attributes[a.name], a.kind)
+}
+
+func (a *attribute) typ() Type      { return a.kind }
+func (a *attribute) String() string { return a.name }
+
+// count is the number of list elements meeting the comparison
+type count struct {
+	list      string
+	op        string
+	threshold operand
+}
+
+func (c *count) value(attributes Attributes) any {
+	items := normalize(attributes[c.list], NumberList).([]float64)
+	threshold := c.threshold.value(attributes)
+
+	n := 0
+	for _, item := range items {
+		if compare(c.op, item, threshold) {
+			n++
+		}
+	}
+
+	return float64(n)
+}
+
+func (c *count) typ() Type { return Number }
+
+func (c *count) String() string {
+	return fmt.Sprintf("count(%s %s %s)", c.list, c.op, c.threshold)
+}
+
+// compare applies the operator to values of the same type, the parser
+// allows ordering operators on numbers only
+func compare(op string, left, right any) bool {
+	if l, ok := left.(float64); ok {
+		r := right.(float64)
+		switch op {
+		case "<":
+			return l < r
+		case "<=":
+			return l <= r
+		case ">":
+			return l > r
+		case ">=":
+			return l >= r
+		}
+	}
+
+	switch op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	}
+
+	return false
+}
+
+// normalize converts an attribute value to the representation of its type,
+// missing and mistyped values become the zero value
+func normalize(value any, kind Type) any {
+	switch kind {
+	case Number:
+		switch v := value.(type) {
+		case float64:
+			return v
+		case int:
+			return float64(v)
+		}
+		return 0.0
+	case String:
+		v, _ := value.(string)
+		return v
+	case Bool:
+		v, _ := value.(bool)
+		return v
+	case NumberList:
+		switch v := value.(type) {
+		case []float64:
+			return v
+		case []int:
+			items := make([]float64, len(v))
+			for i, item := range v {
+				items[i] = float64(item)
+			}
+			return items
+		}
+		return []float64(nil)
+	}
+
+	return value
+}
+
+func format(value any) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,281 @@
+package rules
+
+import (
+	"fmt"
+)
+
+// parser is a recursive descent parser of the grammar:
+//
+//	or         = and { "or" and }
+//	and        = not { "and" not }
+//	not        = "not" not | "(" or ")" | comparison
+//	comparison = operand [ op operand | "in" list ]
+//	operand    = number | string | "true" | "false" | attribute | count
+//	count      = "count" "(" attribute op operand ")"
+//	list       = "[" operand { "," operand } "]"
+type parser struct {
+	tokens []token
+	pos    int
+	schema Schema
+	// depth is the nesting of not and parentheses at the current token
+	depth int
+}
+
+// maxDepth limits the nesting of not and parentheses, so that the parser
+// does not exhaust the stack on a hostile expression
+const maxDepth = 100
+
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "in": true,
+	"true": true, "false": true, "count": true,
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokenIdent && t.text == word {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if t := p.next(); t.kind != kind {
+		return unexpected(t, text)
+	}
+
+	return nil
+}
+
+func unexpected(t token, expected string) error {
+	return &Error{Pos: t.pos, Message: fmt.Sprintf("unexpected %s, expected %s", t, expected)}
+}
+
+func (p *parser) parse() (condition, error) {
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, unexpected(t, "and, or or the end of the expression")
+	}
+
+	return root, nil
+}
+
+func (p *parser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orCondition{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andCondition{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.depth++; p.depth > maxDepth {
+		return nil, &Error{Pos: p.peek().pos, Message: fmt.Sprintf("expression is nested deeper than %d levels", maxDepth)}
+	}
+	defer func() { p.depth-- }()
+
+	if p.keyword("not") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &notCondition{inner: inner}, nil
+	}
+
+	if p.peek().kind == tokenLeftParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(tokenRightParen, `")"`); err != nil {
+			return nil, err
+		}
+
+		return &groupCondition{inner: inner}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (condition, error) {
+	start := p.peek()
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := p.peek(); {
+	case t.kind == tokenOperator:
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err = checkComparison(t, left.typ(), right.typ()); err != nil {
+			return nil, err
+		}
+
+		return &comparison{op: t.text, left: left, right: right}, nil
+	case p.keyword("in"):
+		list, err := p.parseList(left.typ())
+		if err != nil {
+			return nil, err
+		}
+
+		return &membership{value: left, list: list}, nil
+	}
+
+	if left.typ() != Bool {
+		return nil, &Error{Pos: start.pos, Message: fmt.Sprintf("%s is a %s, not a condition", left, left.typ())}
+	}
+
+	return &truth{value: left}, nil
+}
+
+func checkComparison(op token, left, right Type) error {
+	switch {
+	case left == NumberList || right == NumberList:
+		return &Error{Pos: op.pos, Message: "lists can only be compared element by element with count(list op value)"}
+	case left != right:
+		return &Error{Pos: op.pos, Message: fmt.Sprintf("cannot compare a %s with a %s", left, right)}
+	case left != Number && op.text != "==" && op.text != "!=":
+		return &Error{Pos: op.pos, Message: fmt.Sprintf("operator %s is not defined for a %s", op.text, left)}
+	}
+
+	return nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return &literal{val: t.number, kind: Number, text: t.text}, nil
+	case tokenString:
+		return &literal{val: t.text, kind: String, text: t.String()}, nil
+	case tokenIdent:
+	default:
+		return nil, unexpected(t, "a value or an attribute")
+	}
+
+	switch t.text {
+	case "true", "false":
+		return &literal{val: t.text == "true", kind: Bool, text: t.text}, nil
+	case "count":
+		return p.parseCount()
+	}
+
+	if keywords[t.text] {
+		return nil, unexpected(t, "a value or an attribute")
+	}
+
+	kind, ok := p.schema[t.text]
+	if !ok {
+		return nil, &Error{Pos: t.pos, Message: fmt.Sprintf("unknown attribute %s", t.text)}
+	}
+
+	return &attribute{name: t.text, kind: kind}, nil
+}
+
+func (p *parser) parseCount() (operand, error) {
+	if err := p.expect(tokenLeftParen, `"(" after count`); err != nil {
+		return nil, err
+	}
+
+	t := p.next()
+	if t.kind != tokenIdent || p.schema[t.text] != NumberList {
+		return nil, &Error{Pos: t.pos, Message: "count requires a list attribute"}
+	}
+
+	op := p.next()
+	if op.kind != tokenOperator {
+		return nil, unexpected(op, "a comparison operator")
+	}
+
+	value, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkComparison(op, Number, value.typ()); err != nil {
+		return nil, err
+	}
+
+	if err = p.expect(tokenRightParen, `")"`); err != nil {
+		return nil, err
+	}
+
+	return &count{list: t.text, op: op.text, threshold: value}, nil
+}
+
+func (p *parser) parseList(kind Type) ([]operand, error) {
+	if kind != Number && kind != String {
+		return nil, &Error{Pos: p.peek().pos, Message: fmt.Sprintf("in is not defined for a %s", kind)}
+	}
+
+	if err := p.expect(tokenLeftBracket, `"["`); err != nil {
+		return nil, err
+	}
+
+	var list []operand
+	for {
+		start := p.peek()
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if item.typ() != kind {
+			return nil, &Error{Pos: start.pos, Message: fmt.Sprintf("list item %s is not a %s", item, kind)}
+		}
+		list = append(list, item)
+
+		if t := p.next(); t.kind == tokenRightBracket {
+			return list, nil
+		} else if t.kind != tokenComma {
+			return nil, unexpected(t, `"," or "]"`)
+		}
+	}
+}
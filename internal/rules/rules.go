@@ -0,0 +1,120 @@
+// Package rules implements the expression language of program eligibility rules.
+//
+// An expression is a condition on named attributes:
+//
+//	age >= 18 and age <= 50
+//	property_type in ["new_build", "house"]
+//	count(children_ages < 6) >= 1 or count(children_ages < 18) >= 2
+//	employer_accredited and not (region == "moscow")
+//
+// Conditions are comparisons (==, !=, <, <=, >, >=), list membership (in),
+// boolean attributes and their combinations with and, or, not and parentheses.
+// count(list op value) is the number of list elements meeting the comparison.
+// Expressions are checked against a schema of attribute types when compiled,
+// and evaluation explains every failed comparison in plain words.
+package rules
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is the type of an attribute or a value
+type Type int
+
+const (
+	Number Type = iota + 1
+	String
+	Bool
+	NumberList
+)
+
+func (t Type) String() string {
+	switch t {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Bool:
+		return "boolean"
+	case NumberList:
+		return "list of numbers"
+	default:
+		return "unknown"
+	}
+}
+
+// Schema declares the attributes expressions can refer to
+type Schema map[string]Type
+
+// Attributes are the values of the schema attributes: float64 or int for numbers,
+// string, bool and []float64 or []int for lists. Missing attributes are zero.
+type Attributes map[string]any
+
+// Error is an error in an expression at a byte offset
+type Error struct {
+	Pos     int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos+1, e.Message)
+}
+
+// Expression is a compiled condition
+type Expression struct {
+	source string
+	root   condition
+}
+
+// Compile parses the expression and checks it against the schema
+func Compile(source string, schema Schema) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, schema: schema}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// MustCompile compiles an expression known to be valid and panics otherwise
+func MustCompile(source string, schema Schema) *Expression {
+	e, err := Compile(source, schema)
+	if err != nil {
+		panic(fmt.Sprintf("rules: %q: %v", source, err))
+	}
+
+	return e
+}
+
+// String returns the source of the expression
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Result is the outcome of an expression, Reasons explain why it failed
+type Result struct {
+	Passed  bool
+	Reasons []string
+}
+
+// Reason joins the reasons into a sentence
+func (r Result) Reason() string {
+	return strings.Join(r.Reasons, "; ")
+}
+
+// Evaluate checks the condition against the attributes
+func (e *Expression) Evaluate(attributes Attributes) Result {
+	passed, reasons := e.root.eval(attributes)
+	if passed {
+		return Result{Passed: true}
+	}
+
+	return Result{Passed: false, Reasons: reasons}
+}
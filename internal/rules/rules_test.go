@@ -0,0 +1,152 @@
+package rules
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testSchema = Schema{
+	"age":                 Number,
+	"children_ages":       NumberList,
+	"employer_accredited": Bool,
+	"region":              String,
+	"property_type":       String,
+}
+
+func TestEvaluate(t *testing.T) {
+	applicant := Attributes{
+		"age":                 52,
+		"children_ages":       []int{10},
+		"employer_accredited": false,
+		"region":              "moscow",
+		"property_type":       "new_build",
+	}
+
+	tests := []struct {
+		expression string
+		passed     bool
+		reasons    []string
+	}{
+		{
+			expression: "age >= 18 and age <= 50",
+			reasons:    []string{"age is 52, expected <= 50"},
+		},
+		{
+			expression: `property_type in ["new_build", "house"]`,
+			passed:     true,
+		},
+		{
+			expression: `region in ["amur", "sakha"]`,
+			reasons:    []string{`region is "moscow", expected one of ["amur", "sakha"]`},
+		},
+		{
+			expression: "count(children_ages < 6) >= 1 or count(children_ages < 18) >= 2",
+			reasons: []string{
+				"count(children_ages < 6) is 0, expected >= 1",
+				"count(children_ages < 18) is 1, expected >= 2",
+			},
+		},
+		{
+			expression: "employer_accredited",
+			reasons:    []string{"employer_accredited is false"},
+		},
+		{
+			expression: `not (region == "moscow")`,
+			reasons:    []string{`expected not (region == "moscow")`},
+		},
+		{
+			expression: `employer_accredited or (age > 45 and region != "spb")`,
+			passed:     true,
+		},
+		{
+			expression: "not employer_accredited and age == 52",
+			passed:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			e, err := Compile(tt.expression, testSchema)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			result := e.Evaluate(applicant)
+			if result.Passed != tt.passed {
+				t.Errorf("Expected passed %v, got %v", tt.passed, result.Passed)
+			}
+			if !reflect.DeepEqual(result.Reasons, tt.reasons) {
+				t.Errorf("Expected reasons %q, got %q", tt.reasons, result.Reasons)
+			}
+		})
+	}
+}
+
+func TestEvaluate_MissingAttributes(t *testing.T) {
+	e := MustCompile("age < 30 and count(children_ages >= 0) == 0 and not employer_accredited", testSchema)
+	if result := e.Evaluate(Attributes{}); !result.Passed {
+		t.Errorf("Expected missing attributes to be zero, got %q", result.Reasons)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		expression string
+		pos        int
+		message    string
+	}{
+		{expression: "salary > 100", pos: 1, message: "unknown attribute salary"},
+		{expression: "age > 18 and", pos: 13, message: "unexpected end of expression"},
+		{expression: "age = 18", pos: 5, message: "unknown operator"},
+		{expression: `age == "18"`, pos: 5, message: "cannot compare a number with a string"},
+		{expression: `region < "m"`, pos: 8, message: "operator < is not defined for a string"},
+		{expression: "age", pos: 1, message: "age is a number, not a condition"},
+		{expression: "children_ages > 1", pos: 15, message: "lists can only be compared"},
+		{expression: "count(age > 1) > 0", pos: 7, message: "count requires a list attribute"},
+		{expression: `region in ["amur", 1]`, pos: 20, message: "list item 1 is not a string"},
+		{expression: "(age > 18", pos: 10, message: `expected ")"`},
+		{expression: `region == "amur`, pos: 11, message: "unterminated string"},
+		{expression: "age > 18 age < 50", pos: 10, message: "expected and, or or the end of the expression"},
+		{expression: "age > 18 & age < 50", pos: 10, message: "unexpected character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Compile(tt.expression, testSchema)
+
+			var ruleErr *Error
+			if !errors.As(err, &ruleErr) {
+				t.Fatalf("Expected a rule error, got %v", err)
+			}
+			if ruleErr.Pos+1 != tt.pos || !strings.Contains(ruleErr.Message, tt.message) {
+				t.Errorf("Expected %q at position %d, got %v", tt.message, tt.pos, err)
+			}
+		})
+	}
+}
+
+// TestCompile_Nesting checks that deeply nested expressions are rejected
+// instead of exhausting the stack
+func TestCompile_Nesting(t *testing.T) {
+	nested := strings.Repeat("(", maxDepth-1) + "age > 18" + strings.Repeat(")", maxDepth-1)
+	if _, err := Compile(nested, testSchema); err != nil {
+		t.Errorf("Expected %d levels to compile, got %v", maxDepth, err)
+	}
+
+	for _, tt := range []struct {
+		expression string
+		pos        int
+	}{
+		{expression: strings.Repeat("(", 1<<20), pos: maxDepth + 1},
+		{expression: strings.Repeat("not ", 1<<20) + "employer_accredited", pos: 4*maxDepth + 1},
+	} {
+		_, err := Compile(tt.expression, testSchema)
+
+		var ruleErr *Error
+		if !errors.As(err, &ruleErr) || ruleErr.Pos+1 != tt.pos || !strings.Contains(ruleErr.Message, "nested deeper than") {
+			t.Errorf("Expected the nesting error at position %d, got %v", tt.pos, err)
+		}
+	}
+}
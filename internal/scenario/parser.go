@@ -0,0 +1,374 @@
+package scenario
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// Error is a validation error at a position of the scenario file
+type Error struct {
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+	}
+
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+// Errors are all validation errors of a scenario file sorted by position
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Known keys of every mapping of the format
+var (
+	scenarioKeys = []string{"version", "name", "loan", "events"}
+	loanKeys     = []string{"object_cost", "initial_payment", "months", "program", "modifiers", "start_date", "payment_day"}
+	eventKeys    = []string{"date", "type", "rate", "amount", "reduce", "months"}
+
+	// Fields every event type requires and allows in addition to date and type
+	eventFields = map[string]struct{ required, optional []string }{
+		EventRateChange: {required: []string{"rate"}},
+		EventPrepayment: {required: []string{"amount"}, optional: []string{"reduce"}},
+		EventHoliday:    {required: []string{"months"}},
+		EventRefinance:  {required: []string{"rate"}, optional: []string{"months"}},
+	}
+)
+
+// Parse reads and validates a scenario. All problems found are returned
+// together as Errors, each with the line and column it refers to.
+func Parse(data []byte) (Scenario, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		// yaml.v3 syntax errors already carry the line number
+		return Scenario{}, err
+	}
+
+	p := &parser{}
+	if len(root.Content) == 0 {
+		p.errorf(&root, "", "scenario is empty")
+		return Scenario{}, p.errs
+	}
+
+	s := p.scenario(root.Content[0])
+	if len(p.errs) > 0 {
+		sort.SliceStable(p.errs, func(i, j int) bool {
+			if p.errs[i].Line != p.errs[j].Line {
+				return p.errs[i].Line < p.errs[j].Line
+			}
+			return p.errs[i].Column < p.errs[j].Column
+		})
+		return Scenario{}, p.errs
+	}
+
+	sort.SliceStable(s.Events, func(i, j int) bool {
+		return s.Events[i].Date.Before(s.Events[j].Date)
+	})
+
+	return s, nil
+}
+
+// parser walks the node tree collecting errors instead of stopping at the first one
+type parser struct {
+	errs Errors
+}
+
+func (p *parser) errorf(node *yaml.Node, path, format string, args ...any) {
+	p.errs = append(p.errs, &Error{
+		Line:    node.Line,
+		Column:  node.Column,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *parser) scenario(node *yaml.Node) Scenario {
+	var s Scenario
+	fields := p.mapping(node, "", scenarioKeys)
+	if fields == nil {
+		return s
+	}
+
+	if version := p.required(node, fields, "", "version"); version != nil {
+		var ok bool
+		if s.Version, ok = p.int(version, "version"); ok && s.Version != Version {
+			p.errorf(version, "version", "unsupported version %d, expected %d", s.Version, Version)
+		}
+	}
+
+	if name, ok := fields["name"]; ok {
+		s.Name = p.string(name, "name")
+	}
+
+	if loan := p.required(node, fields, "", "loan"); loan != nil {
+		s.Loan = p.loan(loan)
+	}
+
+	if events, ok := fields["events"]; ok {
+		if events.Kind != yaml.SequenceNode {
+			p.errorf(events, "events", "expected a list of events")
+			return s
+		}
+
+		for i, event := range events.Content {
+			s.Events = append(s.Events, p.event(event, fmt.Sprintf("events[%d]", i), s.Loan.StartDate))
+		}
+	}
+
+	return s
+}
+
+func (p *parser) loan(node *yaml.Node) Loan {
+	var loan Loan
+	fields := p.mapping(node, "loan", loanKeys)
+	if fields == nil {
+		return loan
+	}
+
+	if n := p.required(node, fields, "loan", "object_cost"); n != nil {
+		loan.ObjectCost = p.positive(n, "loan.object_cost")
+	}
+
+	if n, ok := fields["initial_payment"]; ok {
+		if loan.InitialPayment, ok = p.decimal(n, "loan.initial_payment"); ok && loan.InitialPayment.IsNegative() {
+			p.errorf(n, "loan.initial_payment", "must not be negative")
+		}
+	}
+
+	if n := p.required(node, fields, "loan", "months"); n != nil {
+		var ok bool
+		if loan.Months, ok = p.int(n, "loan.months"); ok && loan.Months <= 0 {
+			p.errorf(n, "loan.months", "must be positive")
+		}
+	}
+
+	if n := p.required(node, fields, "loan", "program"); n != nil {
+		loan.Program = p.string(n, "loan.program")
+	}
+
+	if n, ok := fields["modifiers"]; ok {
+		if n.Kind != yaml.SequenceNode {
+			p.errorf(n, "loan.modifiers", "expected a list of modifier codes")
+		} else {
+			for i, modifier := range n.Content {
+				loan.Modifiers = append(loan.Modifiers, p.string(modifier, fmt.Sprintf("loan.modifiers[%d]", i)))
+			}
+		}
+	}
+
+	if n := p.required(node, fields, "loan", "start_date"); n != nil {
+		loan.StartDate = p.date(n, "loan.start_date")
+	}
+
+	if n, ok := fields["payment_day"]; ok {
+		if loan.PaymentDay, ok = p.int(n, "loan.payment_day"); ok && (loan.PaymentDay < 1 || loan.PaymentDay > 31) {
+			p.errorf(n, "loan.payment_day", "must be between 1 and 31")
+		}
+	}
+
+	return loan
+}
+
+func (p *parser) event(node *yaml.Node, path string, start time.Time) Event {
+	event := Event{Line: node.Line}
+	fields := p.mapping(node, path, eventKeys)
+	if fields == nil {
+		return event
+	}
+
+	if n := p.required(node, fields, path, "date"); n != nil {
+		event.Date = p.date(n, path+".date")
+		if !start.IsZero() && !event.Date.IsZero() && !event.Date.After(start) {
+			p.errorf(n, path+".date", "must be after the loan start date %s", start.Format(model.DateLayout))
+		}
+	}
+
+	n := p.required(node, fields, path, "type")
+	if n == nil {
+		return event
+	}
+
+	event.Type = p.string(n, path+".type")
+	allowed, ok := eventFields[event.Type]
+	if !ok {
+		p.errorf(n, path+".type", "unknown event type %q, expected one of %s",
+			event.Type, strings.Join([]string{EventRateChange, EventPrepayment, EventHoliday, EventRefinance}, ", "))
+		return event
+	}
+
+	for _, key := range allowed.required {
+		p.required(node, fields, path, key)
+	}
+
+	for key, value := range fields {
+		if key == "date" || key == "type" || contains(allowed.required, key) || contains(allowed.optional, key) {
+			continue
+		}
+		p.errorf(value, path+"."+key, "not allowed for %s events", event.Type)
+	}
+
+	if n, ok := fields["rate"]; ok {
+		event.Rate = p.positive(n, path+".rate")
+	}
+
+	if n, ok := fields["amount"]; ok {
+		event.Amount = p.positive(n, path+".amount")
+	}
+
+	event.Reduce = ReduceTerm
+	if n, ok := fields["reduce"]; ok {
+		event.Reduce = p.string(n, path+".reduce")
+		if event.Reduce != ReduceTerm && event.Reduce != ReducePayment {
+			p.errorf(n, path+".reduce", "expected %s or %s, got %q", ReduceTerm, ReducePayment, event.Reduce)
+		}
+	}
+
+	if n, ok := fields["months"]; ok {
+		if event.Months, ok = p.int(n, path+".months"); ok && event.Months <= 0 {
+			p.errorf(n, path+".months", "must be positive")
+		}
+	}
+
+	return event
+}
+
+// mapping returns the values of a mapping node by key, reporting unknown
+// and duplicate keys. It returns nil if the node is not a mapping.
+func (p *parser) mapping(node *yaml.Node, path string, known []string) map[string]*yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		p.errorf(node, path, "expected a mapping")
+		return nil
+	}
+
+	fields := make(map[string]*yaml.Node, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		keyPath := key.Value
+		if path != "" {
+			keyPath = path + "." + key.Value
+		}
+
+		switch {
+		case !contains(known, key.Value):
+			p.errorf(key, keyPath, "unknown field")
+		case fields[key.Value] != nil:
+			p.errorf(key, keyPath, "duplicate field")
+		default:
+			fields[key.Value] = value
+		}
+	}
+
+	return fields
+}
+
+// required returns the field value or reports it missing at the mapping position
+func (p *parser) required(node *yaml.Node, fields map[string]*yaml.Node, path, key string) *yaml.Node {
+	if value, ok := fields[key]; ok {
+		return value
+	}
+
+	if path != "" {
+		key = path + "." + key
+	}
+	p.errorf(node, key, "required field is missing")
+
+	return nil
+}
+
+func (p *parser) scalar(node *yaml.Node, path, expected string) bool {
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		p.errorf(node, path, "expected %s", expected)
+		return false
+	}
+
+	return true
+}
+
+func (p *parser) string(node *yaml.Node, path string) string {
+	if !p.scalar(node, path, "a string") {
+		return ""
+	}
+
+	return node.Value
+}
+
+func (p *parser) int(node *yaml.Node, path string) (int, bool) {
+	if !p.scalar(node, path, "an integer") {
+		return 0, false
+	}
+
+	var value int
+	if node.Tag != "!!int" || node.Decode(&value) != nil {
+		p.errorf(node, path, "expected an integer, got %q", node.Value)
+		return 0, false
+	}
+
+	return value, true
+}
+
+func (p *parser) decimal(node *yaml.Node, path string) (decimal.Decimal, bool) {
+	if !p.scalar(node, path, "a number") {
+		return decimal.Zero, false
+	}
+
+	value, err := decimal.NewFromString(node.Value)
+	if err != nil || (node.Tag != "!!int" && node.Tag != "!!float") {
+		p.errorf(node, path, "expected a number, got %q", node.Value)
+		return decimal.Zero, false
+	}
+
+	return value, true
+}
+
+func (p *parser) positive(node *yaml.Node, path string) decimal.Decimal {
+	value, ok := p.decimal(node, path)
+	if ok && !value.IsPositive() {
+		p.errorf(node, path, "must be positive")
+	}
+
+	return value
+}
+
+func (p *parser) date(node *yaml.Node, path string) time.Time {
+	if !p.scalar(node, path, "a date") {
+		return time.Time{}
+	}
+
+	value, err := time.Parse(model.DateLayout, node.Value)
+	if err != nil {
+		p.errorf(node, path, "expected a date in the %s format, got %q", model.DateLayout, node.Value)
+		return time.Time{}
+	}
+
+	return value
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
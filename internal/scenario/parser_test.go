@@ -0,0 +1,155 @@
+package scenario
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParse_Example(t *testing.T) {
+	data, err := os.ReadFile("testdata/example.yml")
+	if err != nil {
+		t.Fatalf("Error reading example: %v", err)
+	}
+
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if s.Version != Version || s.Loan.Program != "salary" || s.Loan.Months != 240 ||
+		!s.Loan.ObjectCost.Equal(decimal.NewFromInt(5000000)) ||
+		!s.Loan.StartDate.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected loan: %+v", s.Loan)
+	}
+
+	expected := []struct {
+		typ    string
+		line   int
+		reduce string
+	}{
+		{EventPrepayment, 10, ReducePayment},
+		{EventHoliday, 14, ReduceTerm},
+		{EventRateChange, 17, ReduceTerm},
+		{EventPrepayment, 20, ReduceTerm},
+		{EventRefinance, 23, ReduceTerm},
+	}
+	if len(s.Events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(s.Events))
+	}
+	for i, e := range expected {
+		if s.Events[i].Type != e.typ || s.Events[i].Line != e.line || s.Events[i].Reduce != e.reduce {
+			t.Errorf("Event %d: expected %s at line %d reducing %s, got %+v", i, e.typ, e.line, e.reduce, s.Events[i])
+		}
+	}
+}
+
+func TestParse_SortsEvents(t *testing.T) {
+	s, err := Parse([]byte(`version: 1
+loan: {object_cost: 5000000, initial_payment: 1000000, months: 240, program: base, start_date: 2024-03-01}
+events:
+  - {date: 2025-01-01, type: rate_change, rate: 9}
+  - {date: 2024-06-01, type: holiday, months: 2}
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if s.Events[0].Type != EventHoliday || s.Events[0].Line != 5 {
+		t.Errorf("Expected the holiday first, got %+v", s.Events)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected []string
+	}{
+		{
+			name: "Missing fields",
+			data: "version: 1\nloan:\n  object_cost: 5000000\n",
+			expected: []string{
+				"line 3, column 3: loan.months: required field is missing",
+				"line 3, column 3: loan.program: required field is missing",
+				"line 3, column 3: loan.start_date: required field is missing",
+			},
+		},
+		{
+			name: "Wrong types and unknown fields",
+			data: `version: 2
+loan:
+  object_cost: abc
+  months: 12.5
+  program: salary
+  start_date: 2024-13-01
+  rate: 8
+`,
+			expected: []string{
+				"line 1, column 10: version: unsupported version 2, expected 1",
+				`line 3, column 16: loan.object_cost: expected a number, got "abc"`,
+				`line 4, column 11: loan.months: expected an integer, got "12.5"`,
+				`line 6, column 15: loan.start_date: expected a date in the 2006-01-02 format, got "2024-13-01"`,
+				"line 7, column 3: loan.rate: unknown field",
+			},
+		},
+		{
+			name: "Invalid events",
+			data: `version: 1
+loan: {object_cost: 5000000, months: 240, program: salary, start_date: 2024-03-01}
+events:
+  - date: 2024-01-01
+    type: prepayment
+    amount: -5
+    reduce: rate
+  - date: 2025-01-01
+    type: holiday
+    rate: 5
+  - date: 2025-01-01
+    type: default
+`,
+			expected: []string{
+				"line 4, column 11: events[0].date: must be after the loan start date 2024-03-01",
+				"line 6, column 13: events[0].amount: must be positive",
+				`line 7, column 13: events[0].reduce: expected term or payment, got "rate"`,
+				"line 8, column 5: events[1].months: required field is missing",
+				"line 10, column 11: events[1].rate: not allowed for holiday events",
+				`line 12, column 11: events[2].type: unknown event type "default", expected one of rate_change, prepayment, holiday, refinance`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Expected validation errors, got %v", err)
+			}
+			if len(errs) != len(tt.expected) {
+				t.Fatalf("Expected %d errors, got:\n%v", len(tt.expected), errs)
+			}
+			for i, e := range errs {
+				if e.Error() != tt.expected[i] {
+					t.Errorf("Error %d: expected %q, got %q", i, tt.expected[i], e.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestParse_Syntax(t *testing.T) {
+	_, err := Parse([]byte("version: 1\nloan: [\n"))
+	if err == nil {
+		t.Fatal("Expected a syntax error")
+	}
+
+	var errs Errors
+	if errors.As(err, &errs) {
+		t.Errorf("Expected a YAML syntax error, got validation errors %v", errs)
+	}
+}
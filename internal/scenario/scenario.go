@@ -0,0 +1,62 @@
+// Package scenario defines the YAML format describing a whole loan life:
+// the initial loan and the events changing it over time.
+package scenario
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Version is the scenario format version understood by the parser
+const Version = 1
+
+// Event types
+const (
+	EventRateChange = "rate_change"
+	EventPrepayment = "prepayment"
+	EventHoliday    = "holiday"
+	EventRefinance  = "refinance"
+)
+
+// What a prepayment reduces
+const (
+	ReduceTerm    = "term"
+	ReducePayment = "payment"
+)
+
+// Scenario is a replayable loan timeline
+type Scenario struct {
+	Version int
+	Name    string
+	Loan    Loan
+	// Events sorted by date, events on the same date keep the file order
+	Events []Event
+}
+
+// Loan is the loan as originally signed
+type Loan struct {
+	ObjectCost     decimal.Decimal
+	InitialPayment decimal.Decimal
+	Months         int
+	Program        string
+	Modifiers      []string
+	StartDate      time.Time
+	PaymentDay     int
+}
+
+// Event changes the loan from the first payment on or after its date
+type Event struct {
+	// Line of the event in the scenario file
+	Line int
+	Date time.Time
+	Type string
+	// Rate is the new annual rate of rate_change and refinance events
+	Rate decimal.Decimal
+	// Amount of a prepayment
+	Amount decimal.Decimal
+	// Reduce is what a prepayment reduces: the term or the payment
+	Reduce string
+	// Months of a holiday or the new term of a refinancing
+	Months int
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// annuityPrecision is the number of decimal places kept in every intermediate
+// product of (1 + r)^n and in the annuity coefficient. With 20 places the
+// coefficient is off by less than 1e-18, far below a kopeck on any loan we offer.
+const annuityPrecision int32 = 20
+
+// ErrRateNotPositive occurs for an annuity at a zero or negative rate,
+// which has no coefficient of the annuity formula
+var ErrRateNotPositive = errors.New("rate must be positive")
+
+// annuityCoefficient returns K = r * (1 + r)^n / ((1 + r)^n - 1)
+// where:
+// r - interest rate per period
+// n - number of payments
+func annuityCoefficient(periodRate decimal.Decimal, periods int, trace *model.Trace) (decimal.Decimal, error) {
+	power, coefficient, err := annuity(periodRate, periods, annuityPrecision)
+	if err != nil {
+		return DecimalZero, err
+	}
+
+	trace.Step("power", "(1 + r)^n", power)
+	trace.Step("annuity coefficient", "r * (1 + r)^n / ((1 + r)^n - 1)", coefficient)
+
+	return coefficient, nil
+}
+
+// annuity returns (1 + r)^n and the annuity coefficient for the period rate r
+// and n periods, both rounded to precision decimal places
+func annuity(periodRate decimal.Decimal, periods int, precision int32) (power, coefficient decimal.Decimal, err error) {
+	// (1 + r)^n - 1 is zero at a zero rate, so the coefficient is undefined
+	if !periodRate.IsPositive() {
+		return DecimalZero, DecimalZero, fmt.Errorf("%w, got %s per period", ErrRateNotPositive, periodRate)
+	}
+
+	power = powInt(DecimalOne.Add(periodRate), periods, precision)
+	coefficient = periodRate.Mul(power).DivRound(power.Sub(DecimalOne), precision)
+
+	return power, coefficient, nil
+}
+
+// powInt returns base^n for n >= 0 by exponentiation by squaring. Unlike
+// decimal.Pow, which keeps every digit and so grows the mantissa by the digits
+// of the base at each multiplication, every product is rounded to precision
+// decimal places, bounding both the cost and the error: O(log n) multiplications
+// of numbers with at most precision + integer digits.
+func powInt(base decimal.Decimal, n int, precision int32) decimal.Decimal {
+	result := DecimalOne
+
+	for n > 0 {
+		if n&1 == 1 {
+			result = result.Mul(base).Round(precision)
+		}
+		n >>= 1
+
+		if n > 0 {
+			base = base.Mul(base).Round(precision)
+		}
+	}
+
+	return result
+}
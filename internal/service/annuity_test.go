@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// maxTestMonths is the longest term checked for programs without a term limit
+const maxTestMonths = 360
+
+// exactAnnuity computes annuity coefficients for the period rate r without
+// rounding: with r = a / s the power is (s + a)^n / s^n, kept as integers and
+// extended by one period at a time
+type exactAnnuity struct {
+	a, s       *big.Int
+	num, denom *big.Int
+}
+
+func newExactAnnuity(periodRate decimal.Decimal) *exactAnnuity {
+	a := periodRate.Coefficient()
+	s := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-periodRate.Exponent())), nil)
+
+	return &exactAnnuity{
+		a:     a,
+		s:     s,
+		num:   big.NewInt(1),
+		denom: big.NewInt(1),
+	}
+}
+
+// next advances the power by one period and returns the coefficient
+// a * A / (s * (A - D)) truncated to places decimal places
+func (e *exactAnnuity) next(places int32) decimal.Decimal {
+	e.num.Mul(e.num, new(big.Int).Add(e.s, e.a))
+	e.denom.Mul(e.denom, e.s)
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	num := new(big.Int).Mul(e.a, e.num)
+	num.Mul(num, scale)
+	denom := new(big.Int).Sub(e.num, e.denom)
+	denom.Mul(denom, e.s)
+
+	return decimal.NewFromBigInt(num.Quo(num, denom), -places)
+}
+
+// TestAnnuity_AllPrograms compares the coefficient and the rounded payment with
+// the exact values for every rate and term our programs allow
+func TestAnnuity_AllPrograms(t *testing.T) {
+	tolerance := decimal.New(1, -18)
+	monthly := frequencies[model.FrequencyMonthly]
+
+	for _, program := range DefaultPrograms {
+		maxLoan := program.Limits.MaxLoan
+		if maxLoan.IsZero() {
+			maxLoan = decimal.NewFromInt(30000000)
+		}
+		for _, capped := range program.Limits.RegionMaxLoan {
+			maxLoan = decimal.Max(maxLoan, capped)
+		}
+
+		maxMonths := program.Limits.MaxMonths
+		if maxMonths == 0 {
+			maxMonths = maxTestMonths
+		}
+
+		for _, rate := range programTestRates(program) {
+			periodRate := monthly.periodRate(rate)
+			exact := newExactAnnuity(periodRate)
+
+			for months := 1; months <= maxMonths; months++ {
+				want := exact.next(30)
+				if months < program.Limits.MinMonths {
+					continue
+				}
+
+				_, got, err := annuity(periodRate, months, annuityPrecision)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if got.Sub(want).Abs().GreaterThan(tolerance) {
+					t.Fatalf("%s at %s%% for %d months: expected coefficient %s, got %s",
+						program.Code, rate, months, want, got)
+				}
+
+				if wantPayment, gotPayment := maxLoan.Mul(want).Round(0), maxLoan.Mul(got).Round(0); !gotPayment.Equal(wantPayment) {
+					t.Errorf("%s at %s%% for %d months: expected payment %s, got %s",
+						program.Code, rate, months, wantPayment, gotPayment)
+				}
+			}
+		}
+	}
+}
+
+// programTestRates returns every rate of the program: each tier alone and
+// with each of its modifiers
+func programTestRates(program Program) []decimal.Decimal {
+	var rates []decimal.Decimal
+	for _, tier := range program.Tiers {
+		rates = append(rates, tier.Rate)
+		for _, m := range program.Modifiers {
+			rates = append(rates, tier.Rate.Add(m.Delta))
+		}
+	}
+
+	return rates
+}
+
+func TestPowInt(t *testing.T) {
+	tests := []struct {
+		base     string
+		n        int
+		expected string
+	}{
+		{base: "2", n: 0, expected: "1"},
+		{base: "2", n: 10, expected: "1024"},
+		{base: "1.5", n: 3, expected: "3.375"},
+		{base: "1.1", n: 13, expected: "3.4522712143931"},
+	}
+
+	for _, tt := range tests {
+		got := powInt(decimal.RequireFromString(tt.base), tt.n, annuityPrecision)
+		if !got.Equal(decimal.RequireFromString(tt.expected)) {
+			t.Errorf("%s^%d: expected %s, got %s", tt.base, tt.n, tt.expected, got)
+		}
+	}
+}
+
+func TestAnnuity_RateNotPositive(t *testing.T) {
+	for _, rate := range []string{"0", "-0.001"} {
+		if _, _, err := annuity(decimal.RequireFromString(rate), 240, annuityPrecision); !errors.Is(err, ErrRateNotPositive) {
+			t.Errorf("Expected error %v at rate %s, got %v", ErrRateNotPositive, rate, err)
+		}
+	}
+}
+
+var benchmarkPower decimal.Decimal
+
+func BenchmarkPowInt(b *testing.B) {
+	base := DecimalOne.Add(frequencies[model.FrequencyMonthly].periodRate(decimal.NewFromInt(8)))
+
+	for i := 0; i < b.N; i++ {
+		benchmarkPower = powInt(base, maxTestMonths, annuityPrecision)
+	}
+}
+
+func BenchmarkDecimalPow(b *testing.B) {
+	base := DecimalOne.Add(frequencies[model.FrequencyMonthly].periodRate(decimal.NewFromInt(8)))
+	n := decimal.NewFromInt(maxTestMonths)
+
+	for i := 0; i < b.N; i++ {
+		benchmarkPower = base.Pow(n)
+	}
+}
+
+func BenchmarkAnnuityCoefficient(b *testing.B) {
+	periodRate := frequencies[model.FrequencyMonthly].periodRate(decimal.NewFromInt(8))
+
+	for i := 0; i < b.N; i++ {
+		benchmarkPower, _ = annuityCoefficient(periodRate, maxTestMonths, nil)
+	}
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -10,16 +12,8 @@ import (
 )
 
 var (
-	// Annual interest rates for different credit programs
-	RateSalaryProgram   = decimal.NewFromFloat(8.0)
-	RateMilitaryProgram = decimal.NewFromFloat(9.0)
-	RateBaseProgram     = decimal.NewFromFloat(10.0)
-
-	// Minimum percentage of initial payment
-	MinInitialPaymentPercent = decimal.NewFromFloat(0.2)
-
 	// Date format for the last payment
-	DateFormat = "2006-01-02"
+	DateFormat = model.DateLayout
 
 	// Constants for mathematical calculations
 	DecimalZero    = decimal.NewFromInt(0)
@@ -29,6 +23,19 @@ var (
 
 	// Error for when no program is selected
 	ErrNoProgramSelected = errors.New("no mortgage program selected")
+
+	// Error for a program code missing from the catalog
+	ErrUnknownProgram = errors.New("unknown mortgage program")
+
+	// Error for a program definition the catalog cannot accept
+	ErrInvalidProgram = errors.New("invalid mortgage program")
+)
+
+// Feature flags changing the calculation, programs can be rolled out with
+// flags of any name
+const (
+	// FeatureBankersRounding rounds the payment half to even
+	FeatureBankersRounding = "bankers_rounding"
 )
 
 // Calculator defines the interface for mortgage calculations
@@ -36,80 +43,379 @@ type Calculator interface {
 	Calculate(req model.ExecuteRequest, baseTime time.Time) (model.Aggregates, error)
 }
 
+// Explainer calculates a mortgage together with the trace of the calculation
+type Explainer interface {
+	Explain(req model.ExecuteRequest, baseTime time.Time) (model.Aggregates, *model.Trace, error)
+}
+
 // MortCalculator implements mortgage parameter calculations
-type MortCalculator struct{}
+type MortCalculator struct {
+	catalog       atomic.Pointer[catalog]
+	contributions militaryContributions
+	// store persists catalog changes when set
+	store CatalogStore
+	// mu serializes catalog changes, calculations read the current version without locking
+	mu sync.Mutex
+}
 
 // NewMortCalculator creates a new instance of the mortgage calculator
 func NewMortCalculator() *MortCalculator {
-	return &MortCalculator{}
+	c := &MortCalculator{
+		contributions: DefaultMilitaryContributions,
+	}
+	c.catalog.Store(newCatalog(1, time.Now().UTC(), DefaultPrograms, defaultCoefficients()))
+
+	return c
+}
+
+// current returns the catalog version in effect
+func (c *MortCalculator) current() *catalog {
+	return c.catalog.Load()
+}
+
+// SetPrograms replaces the program catalog. The catalog is validated as a whole
+// and left unchanged when any program is invalid. The programs come from the
+// configuration, which is read again on start, so they are not saved to the store.
+func (c *MortCalculator) SetPrograms(programs []Program) error {
+	_, err := c.change(false, func([]Program) ([]Program, error) {
+		return programs, nil
+	})
+
+	return err
+}
+
+// SetLimits replaces the loan limits of the program with the given code
+func (c *MortCalculator) SetLimits(code string, limits Limits) error {
+	_, err := c.change(true, func(programs []Program) ([]Program, error) {
+		i, err := indexOf(programs, code)
+		if err != nil {
+			return nil, err
+		}
+
+		programs[i].Limits = limits
+
+		return programs, nil
+	})
+
+	return err
+}
+
+// SetMilitaryContributions replaces the annual state contributions of the military program
+func (c *MortCalculator) SetMilitaryContributions(contributions map[int]decimal.Decimal) {
+	c.contributions = contributions
 }
 
 // Calculate performs mortgage calculation based on input data
-// baseTime is used as the base date for calculating the last payment date (for testing)
+// baseTime is used as the contract date when the request does not specify one
 func (c *MortCalculator) Calculate(req model.ExecuteRequest, baseTime time.Time) (model.Aggregates, error) {
-	if req.ObjectCost.LessThanOrEqual(DecimalZero) || req.Months <= 0 {
-		return model.Aggregates{}, errors.New("invalid params")
+	return c.calculate(req, baseTime, nil)
+}
+
+// Explain performs the calculation and returns the trace of how the result was derived.
+// The trace is returned on validation errors too and shows the failed check.
+func (c *MortCalculator) Explain(req model.ExecuteRequest, baseTime time.Time) (model.Aggregates, *model.Trace, error) {
+	trace := &model.Trace{}
+	agg, err := c.calculate(req, baseTime, trace)
+
+	return agg, trace, err
+}
+
+func (c *MortCalculator) calculate(req model.ExecuteRequest, baseTime time.Time, trace *model.Trace) (model.Aggregates, error) {
+	return c.calculateIn(c.current(), req, baseTime, trace)
+}
+
+// calculateIn calculates against the given catalog version, so that comparisons
+// across programs are not split by a concurrent catalog change
+func (c *MortCalculator) calculateIn(cat *catalog, req model.ExecuteRequest, baseTime time.Time, trace *model.Trace) (model.Aggregates, error) {
+	if req.AsOf != nil {
+		baseTime = req.AsOf.Time
+	}
+	if baseTime.IsZero() {
+		baseTime = time.Now()
+	}
+
+	terms, err := c.resolveTerms(cat, req, baseTime, trace)
+	if err != nil {
+		return model.Aggregates{}, err
+	}
+
+	plan, err := buildRepayment(req, terms, cat.coefficients, trace)
+	if err != nil {
+		return model.Aggregates{}, err
+	}
+
+	agg := model.Aggregates{
+		ProgramName:     terms.program.Name,
+		Lender:          terms.program.Lender,
+		CatalogVersion:  cat.version,
+		Rate:            terms.rate.rate,
+		BaseRate:        terms.rate.tier.Rate,
+		Modifiers:       terms.rate.modifiers,
+		RateTier:        terms.rate.tier,
+		AsOf:            baseTime.Format(DateFormat),
+		LoanSum:         terms.loanSum,
+		MonthlyPayment:  plan.payment,
+		Overpayment:     plan.overpayment,
+		LastPaymentDate: plan.lastPaymentDate.Format(DateFormat),
+		Compounding:     req.Compounding,
+		AnnuityDue:      req.AnnuityDue,
+	}
+
+	if plan.termMonths > 0 {
+		agg.TermMonths = plan.termMonths
+	}
+
+	if !terms.rate.effectiveFrom.IsZero() {
+		agg.RateEffectiveFrom = terms.rate.effectiveFrom.Format(DateFormat)
+	}
+
+	terms.calendar.frequency.describe(&agg, plan.payment, plan.periods)
+
+	if len(req.Disbursements) > 0 {
+		agg.ConstructionInterest = &plan.construction.interest
+	}
+
+	if req.Holiday != nil {
+		agg.HolidayDeferred = &plan.holiday.deferred
+		agg.HolidayCost = &plan.holiday.cost
 	}
 
-	rate, err := c.getProgramRate(req.Program)
+	agg.Military, err = c.calculateMilitary(req, terms.calendar, terms.loanSum, plan.periodRate, plan.payment, plan.periods)
 	if err != nil {
 		return model.Aggregates{}, err
 	}
 
-	minPayment := req.ObjectCost.Mul(MinInitialPaymentPercent)
-	if req.InitialPayment.LessThan(minPayment) {
-		return model.Aggregates{}, model.ErrInitialPaymentLow
+	return agg, nil
+}
+
+// loanTerms are the validated request parameters the schedule is built from
+type loanTerms struct {
+	program  Program
+	rate     programRate
+	loanSum  decimal.Decimal
+	calendar paymentCalendar
+}
+
+// resolveTerms validates the request against the selected program
+// and resolves its rate and payment calendar
+func (c *MortCalculator) resolveTerms(cat *catalog, req model.ExecuteRequest, baseTime time.Time, trace *model.Trace) (loanTerms, error) {
+	trace.Check("object cost", req.ObjectCost, "> 0", req.ObjectCost.IsPositive())
+	trace.Check("term", req.Months, "> 0 months", req.Months > 0)
+	if req.ObjectCost.LessThanOrEqual(DecimalZero) || req.Months <= 0 {
+		return loanTerms{}, errors.New("invalid params")
 	}
 
-	currentTime := baseTime
-	if currentTime.IsZero() {
-		currentTime = time.Now()
+	program, err := cat.program(req.Program.Code, req.Features)
+	if err != nil {
+		return loanTerms{}, err
+	}
+	trace.Step("program", "", program.Code)
+
+	rate, err := c.getProgramRate(program, req, baseTime, trace)
+	if err != nil {
+		return loanTerms{}, err
 	}
 
 	loanSum := req.ObjectCost.Sub(req.InitialPayment)
+	trace.Step("loan sum", "object cost - initial payment", loanSum)
+	if err = program.checkLoan(req, loanSum, trace); err != nil {
+		return loanTerms{}, err
+	}
+
+	calendar, err := newPaymentCalendar(req, baseTime)
+	if err != nil {
+		return loanTerms{}, err
+	}
 
-	// Calculate monthly payment using annuity formula:
-	// P = (S * r * (1 + r)^n) / ((1 + r)^n - 1)
-	// where:
-	// P - monthly payment
-	// S - loan amount
-	// r - monthly interest rate (annual rate / 12)
-	// n - number of months (loan term)
+	if !calendar.frequency.monthly() && (req.Holiday != nil || req.ServicemanBirthDate != nil) {
+		return loanTerms{}, model.ErrMonthlyOnly
+	}
+
+	if req.AnnuityDue && (len(req.Disbursements) > 0 || req.Holiday != nil || req.ServicemanBirthDate != nil) {
+		return loanTerms{}, model.ErrAnnuityDueConflict
+	}
+
+	return loanTerms{program: program, rate: rate, loanSum: loanSum, calendar: calendar}, nil
+}
+
+// repayment is the annuity schedule of the loan
+type repayment struct {
+	periodRate      decimal.Decimal
+	periods         int
+	payment         decimal.Decimal
+	overpayment     decimal.Decimal
+	lastPaymentDate time.Time
+	// termMonths is the term shortened by accelerated payments, zero otherwise
+	termMonths   int
+	construction constructionPhase
+	holiday      holidayEffect
+}
 
+// buildRepayment computes the annuity schedule for the resolved terms
+func buildRepayment(req model.ExecuteRequest, terms loanTerms, coefficients *coefficientTable, trace *model.Trace) (repayment, error) {
+	rate := terms.rate.rate
+	frequency := terms.calendar.frequency
 	monthlyRate := rate.Div(DecimalHundred).Div(DecimalTwelve)
 
-	// (1 + r)^n
-	power := DecimalOne.Add(monthlyRate).Pow(decimal.NewFromInt(int64(req.Months)))
+	// For off-plan loans the annuity starts only after the final tranche,
+	// until then the client pays interest on the drawn amount monthly
+	construction, err := calculateConstruction(req.Disbursements, terms.loanSum, monthlyRate, req.Months)
+	if err != nil {
+		return repayment{}, err
+	}
+
+	periods, err := frequency.periods(req.Months - construction.months)
+	if err != nil {
+		return repayment{}, err
+	}
+	trace.Step("number of payments", frequency.code, periods)
+
+	periodRate, err := resolvePeriodRate(rate, frequency, req.Compounding)
+	if err != nil {
+		return repayment{}, err
+	}
+	trace.Step("period rate", periodRateFormula(frequency, req.Compounding), periodRate)
+
+	var payment, totalPayment decimal.Decimal
+	termMonths := 0
+	if frequency.accelerated {
+		// Half of the monthly payment every period repays the loan before the term
+		payment, err = acceleratedPayment(terms.loanSum, rate, req.Months-construction.months, req.Compounding,
+			req.AnnuityDue, req.Features.Enabled(FeatureBankersRounding), coefficients, trace)
+		if err != nil {
+			return repayment{}, err
+		}
 
-	// r * (1 + r)^n / ((1 + r)^n - 1)
-	annuityCoeff := monthlyRate.Mul(power).Div(power.Sub(DecimalOne))
+		periods, totalPayment = repayAccelerated(terms.loanSum, periodRate, payment, req.AnnuityDue, periods)
+		trace.Step("number of payments", "until the balance is repaid", periods)
+
+		termMonths = construction.months + frequency.termMonths(periods)
+		trace.Step("term, months", "shortened by the accelerated payments", termMonths)
+	} else {
+		coefficient, err := coefficients.coefficient(periodRate, periods, trace)
+		if err != nil {
+			return repayment{}, err
+		}
+		payment = annuityPayment(terms.loanSum, periodRate, coefficient, req.AnnuityDue,
+			req.Features.Enabled(FeatureBankersRounding), trace)
+		totalPayment = payment.Mul(decimal.NewFromInt(int64(periods)))
+	}
+
+	holiday, err := calculateHoliday(req.Holiday, terms.loanSum, periodRate, payment, periods)
+	if err != nil {
+		return repayment{}, err
+	}
 
-	monthlyPayment := loanSum.Mul(annuityCoeff).Round(0)
+	overpayment := totalPayment.Sub(terms.loanSum).Add(construction.interest).Add(holiday.cost).Round(0)
+	trace.Step("overpayment", "P * n - S + construction interest + holiday cost", overpayment)
 
-	totalPayment := monthlyPayment.Mul(decimal.NewFromInt(int64(req.Months)))
-	overpayment := totalPayment.Sub(loanSum).Round(0)
+	// Construction months are counted in the schedule at the same frequency
+	constructionPeriods, err := frequency.periods(construction.months)
+	if err != nil {
+		return repayment{}, err
+	}
 
-	lastPaymentDate := currentTime.AddDate(0, req.Months, 0)
+	lastPaymentDate := terms.calendar.paymentDate(constructionPeriods + periods + holiday.months)
+	trace.Step("last payment date", "", lastPaymentDate.Format(DateFormat))
 
-	return model.Aggregates{
-		Rate:            rate,
-		LoanSum:         loanSum,
-		MonthlyPayment:  monthlyPayment,
-		Overpayment:     overpayment,
-		LastPaymentDate: lastPaymentDate.Format(DateFormat),
+	return repayment{
+		periodRate:      periodRate,
+		periods:         periods,
+		payment:         payment,
+		overpayment:     overpayment,
+		lastPaymentDate: lastPaymentDate,
+		termMonths:      termMonths,
+		construction:    construction,
+		holiday:         holiday,
 	}, nil
 }
 
-// getProgramRate returns the interest rate based on the selected program
-func (c *MortCalculator) getProgramRate(program model.ProgramRequest) (decimal.Decimal, error) {
-	switch {
-	case program.Salary:
-		return RateSalaryProgram, nil
-	case program.Military:
-		return RateMilitaryProgram, nil
-	case program.Base:
-		return RateBaseProgram, nil
-	default:
-		return DecimalZero, ErrNoProgramSelected
+// calculateMilitary models the state contributions when the serviceman birth date is given
+func (c *MortCalculator) calculateMilitary(req model.ExecuteRequest, calendar paymentCalendar,
+	loanSum, monthlyRate, payment decimal.Decimal, months int,
+) (*model.MilitarySummary, error) {
+	if req.ServicemanBirthDate == nil {
+		return nil, nil
+	}
+
+	if req.Program.Code != MilitaryProgram.Code {
+		return nil, model.ErrServicemanNotMilitary
+	}
+
+	return c.contributions.calculate(req.ServicemanBirthDate.Time, calendar, loanSum, monthlyRate, payment, months)
+}
+
+// annuityPayment returns the rounded annuity payment for the loan using the formula:
+// P = S * K
+// where:
+// P - payment per period
+// S - loan amount
+// K - annuity coefficient, divided by (1 + r) when payments are made
+// at the start of each period (annuity-due)
+// The payment is rounded half to even with bankers rounding, half away from zero otherwise.
+func annuityPayment(loanSum, periodRate, coefficient decimal.Decimal, due, bankersRounding bool, trace *model.Trace) decimal.Decimal {
+	payment := loanSum.Mul(coefficient)
+	if due {
+		payment = payment.Div(DecimalOne.Add(periodRate))
+		trace.Step("payment", "S * K / (1 + r)", payment)
+	} else {
+		trace.Step("payment", "S * K", payment)
+	}
+
+	if bankersRounding {
+		rounded := payment.RoundBank(0)
+		trace.Step("rounded payment", "rounded half to even to whole rubles", rounded)
+
+		return rounded
+	}
+
+	rounded := payment.Round(0)
+	trace.Step("rounded payment", "rounded half away from zero to whole rubles", rounded)
+
+	return rounded
+}
+
+// programRate is the annual rate resolved for a request
+type programRate struct {
+	// loan-to-value tier providing the base rate
+	tier model.RateTier
+	// modifiers applied on top of the base rate
+	modifiers []model.RateModifier
+	// final rate
+	rate decimal.Decimal
+	// start of the rate period the tier comes from, zero for the base tiers
+	effectiveFrom time.Time
+}
+
+// getProgramRate returns the rate of the program valid on the asOf date:
+// the tier matching the initial payment adjusted by the requested modifiers
+func (c *MortCalculator) getProgramRate(program Program, req model.ExecuteRequest, asOf time.Time, trace *model.Trace) (programRate, error) {
+	tiers, effectiveFrom := program.tiersOn(asOf)
+	if !effectiveFrom.IsZero() {
+		trace.Step("rate table", "effective on "+asOf.Format(DateFormat), effectiveFrom.Format(DateFormat))
+	}
+
+	initialPercent := req.InitialPayment.Mul(DecimalHundred).Div(req.ObjectCost)
+	tier, err := selectTier(tiers, initialPercent)
+	if len(tiers) > 0 {
+		trace.Check("initial payment, %", initialPercent.Round(2), ">= "+tiers[0].MinInitialPayment.String(), err == nil)
+	}
+	if err != nil {
+		return programRate{}, err
+	}
+	trace.Step("base rate", "tier from "+tier.MinInitialPayment.String()+"% initial payment", tier.Rate)
+
+	modifiers, err := program.selectModifiers(req.Modifiers)
+	if err != nil {
+		return programRate{}, err
 	}
+
+	rate := tier.Rate
+	for _, m := range modifiers {
+		rate = rate.Add(m.Delta)
+		trace.Step("modifier "+m.Code, m.Description, m.Delta)
+	}
+	trace.Step("rate", "base rate + modifiers", rate)
+
+	return programRate{tier: tier, modifiers: modifiers, rate: rate, effectiveFrom: effectiveFrom}, nil
 }
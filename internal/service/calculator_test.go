@@ -2,6 +2,8 @@ package service
 
 import (
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,9 +29,7 @@ func TestCalculate_HappyPath(t *testing.T) {
 				ObjectCost:     decimal.NewFromInt(5000000),
 				InitialPayment: decimal.NewFromInt(1000000), // 20%
 				Months:         240,
-				Program: model.ProgramRequest{
-					Salary: true,
-				},
+				Program:        model.ProgramRequest{Code: "salary"},
 			},
 			expected: model.Aggregates{
 				Rate:            decimal.NewFromFloat(8.0),
@@ -46,9 +46,7 @@ func TestCalculate_HappyPath(t *testing.T) {
 				ObjectCost:     decimal.NewFromInt(8000000),
 				InitialPayment: decimal.NewFromInt(2000000), // 25%
 				Months:         180,
-				Program: model.ProgramRequest{
-					Military: true,
-				},
+				Program:        model.ProgramRequest{Code: "military"},
 			},
 			expected: model.Aggregates{
 				Rate:            decimal.NewFromFloat(9.0),
@@ -63,17 +61,15 @@ func TestCalculate_HappyPath(t *testing.T) {
 			name: "Base program (base)",
 			request: model.ExecuteRequest{
 				ObjectCost:     decimal.NewFromInt(3000000),
-				InitialPayment: decimal.NewFromInt(1000000), // 33.33%
+				InitialPayment: decimal.NewFromInt(1000000), // 33.33%, 30% tier
 				Months:         120,
-				Program: model.ProgramRequest{
-					Base: true,
-				},
+				Program:        model.ProgramRequest{Code: "base"},
 			},
 			expected: model.Aggregates{
-				Rate:            decimal.NewFromFloat(10.0),
+				Rate:            decimal.NewFromFloat(9.5),
 				LoanSum:         decimal.NewFromInt(2000000),
-				MonthlyPayment:  decimal.NewFromInt(26430),
-				Overpayment:     decimal.NewFromInt(1171600),
+				MonthlyPayment:  decimal.NewFromInt(25880),
+				Overpayment:     decimal.NewFromInt(1105600),
 				LastPaymentDate: "2034-02-18",
 			},
 			expectedErr: nil,
@@ -127,9 +123,7 @@ func TestCalculate_Example(t *testing.T) {
 		ObjectCost:     decimal.NewFromInt(5000000),
 		InitialPayment: decimal.NewFromInt(1000000),
 		Months:         240,
-		Program: model.ProgramRequest{
-			Salary: true,
-		},
+		Program:        model.ProgramRequest{Code: "salary"},
 	}
 
 	// Expected results from specification
@@ -186,9 +180,7 @@ func TestCalculate_ErrorCases(t *testing.T) {
 				ObjectCost:     decimal.NewFromInt(5000000),
 				InitialPayment: decimal.NewFromInt(500000), // 10% < 20%
 				Months:         240,
-				Program: model.ProgramRequest{
-					Salary: true,
-				},
+				Program:        model.ProgramRequest{Code: "salary"},
 			},
 			expectedErr: model.ErrInitialPaymentLow,
 		},
@@ -198,9 +190,7 @@ func TestCalculate_ErrorCases(t *testing.T) {
 				ObjectCost:     decimal.NewFromInt(0),
 				InitialPayment: decimal.NewFromInt(1000000),
 				Months:         240,
-				Program: model.ProgramRequest{
-					Salary: true,
-				},
+				Program:        model.ProgramRequest{Code: "salary"},
 			},
 			expectedErr: errors.New("invalid params"),
 		},
@@ -210,9 +200,7 @@ func TestCalculate_ErrorCases(t *testing.T) {
 				ObjectCost:     decimal.NewFromInt(5000000),
 				InitialPayment: decimal.NewFromInt(1000000),
 				Months:         -10,
-				Program: model.ProgramRequest{
-					Salary: true,
-				},
+				Program:        model.ProgramRequest{Code: "salary"},
 			},
 			expectedErr: errors.New("invalid params"),
 		},
@@ -256,9 +244,7 @@ func TestCalculate_Rounding(t *testing.T) {
 		ObjectCost:     decimal.NewFromInt(5123456), // Amount that should give non-integer values
 		InitialPayment: decimal.NewFromInt(1123456),
 		Months:         137, // Non-standard number of months
-		Program: model.ProgramRequest{
-			Salary: true,
-		},
+		Program:        model.ProgramRequest{Code: "salary"},
 	}
 
 	result, err := calculator.Calculate(request, baseTime)
@@ -288,3 +274,1447 @@ func TestCalculate_Rounding(t *testing.T) {
 		t.Errorf("Incorrect rounding. Overpayment difference: %v", diff)
 	}
 }
+
+func TestCalculate_Construction(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+		Disbursements: []model.Disbursement{
+			{Month: 12, Amount: decimal.NewFromInt(1000000)},
+			{Month: 0, Amount: decimal.NewFromInt(2000000)},
+			{Month: 6, Amount: decimal.NewFromInt(1000000)},
+		},
+	}
+
+	result, err := calculator.Calculate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 2M drawn for 12 months and 1M for 6 months at 8% / 12
+	expectedInterest := decimal.NewFromInt(200000)
+	if result.ConstructionInterest == nil || !result.ConstructionInterest.Equal(expectedInterest) {
+		t.Errorf("Expected construction interest %v, got %v", expectedInterest, result.ConstructionInterest)
+	}
+
+	// The annuity covers the remaining 228 months after the final draw
+	expectedPayment := decimal.NewFromInt(34180)
+	if !result.MonthlyPayment.Equal(expectedPayment) {
+		t.Errorf("Expected monthly payment %v, got %v", expectedPayment, result.MonthlyPayment)
+	}
+
+	expectedOverpayment := decimal.NewFromInt(3993040)
+	if !result.Overpayment.Equal(expectedOverpayment) {
+		t.Errorf("Expected overpayment %v, got %v", expectedOverpayment, result.Overpayment)
+	}
+
+	if result.LastPaymentDate != "2044-02-18" {
+		t.Errorf("Expected last payment date 2044-02-18, got %v", result.LastPaymentDate)
+	}
+}
+
+func TestCalculate_ConstructionErrors(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	tests := []struct {
+		name          string
+		disbursements []model.Disbursement
+		expectedErr   error
+	}{
+		{
+			name: "Tranches do not cover the loan",
+			disbursements: []model.Disbursement{
+				{Month: 0, Amount: decimal.NewFromInt(3000000)},
+			},
+			expectedErr: model.ErrDisbursementSum,
+		},
+		{
+			name: "Final draw after the end of the term",
+			disbursements: []model.Disbursement{
+				{Month: 0, Amount: decimal.NewFromInt(2000000)},
+				{Month: 240, Amount: decimal.NewFromInt(2000000)},
+			},
+			expectedErr: model.ErrDisbursementInvalid,
+		},
+		{
+			name: "Non-positive tranche",
+			disbursements: []model.Disbursement{
+				{Month: 0, Amount: decimal.NewFromInt(4000000)},
+				{Month: 3, Amount: decimal.NewFromInt(0)},
+			},
+			expectedErr: model.ErrDisbursementInvalid,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(5000000),
+				InitialPayment: decimal.NewFromInt(1000000),
+				Months:         240,
+				Program:        model.ProgramRequest{Code: "salary"},
+				Disbursements:  tc.disbursements,
+			}
+
+			if _, err := calculator.Calculate(request, baseTime); err != tc.expectedErr {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCalculate_Holiday(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+		Holiday:        &model.PaymentHoliday{StartMonth: 13, Months: 6},
+	}
+
+	result, err := calculator.Calculate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The regular payment is not affected by the holiday
+	expectedPayment := decimal.NewFromInt(33458)
+	if !result.MonthlyPayment.Equal(expectedPayment) {
+		t.Errorf("Expected monthly payment %v, got %v", expectedPayment, result.MonthlyPayment)
+	}
+
+	expectedCost := decimal.NewFromInt(742)
+	if result.HolidayCost == nil || !result.HolidayCost.Equal(expectedCost) {
+		t.Errorf("Expected holiday cost %v, got %v", expectedCost, result.HolidayCost)
+	}
+
+	// Six frozen payments plus the extra interest are moved to the end
+	expectedDeferred := decimal.NewFromInt(201490)
+	if result.HolidayDeferred == nil || !result.HolidayDeferred.Equal(expectedDeferred) {
+		t.Errorf("Expected deferred amount %v, got %v", expectedDeferred, result.HolidayDeferred)
+	}
+
+	expectedOverpayment := decimal.NewFromInt(4029920 + 742)
+	if !result.Overpayment.Equal(expectedOverpayment) {
+		t.Errorf("Expected overpayment %v, got %v", expectedOverpayment, result.Overpayment)
+	}
+
+	if result.LastPaymentDate != "2044-08-18" {
+		t.Errorf("Expected last payment date 2044-08-18, got %v", result.LastPaymentDate)
+	}
+}
+
+func TestCalculate_HolidayErrors(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	tests := []struct {
+		name        string
+		holiday     model.PaymentHoliday
+		expectedErr error
+	}{
+		{
+			name:        "Longer than 6 months",
+			holiday:     model.PaymentHoliday{StartMonth: 1, Months: 7},
+			expectedErr: model.ErrHolidayTooLong,
+		},
+		{
+			name:        "Ends after the term",
+			holiday:     model.PaymentHoliday{StartMonth: 238, Months: 6},
+			expectedErr: model.ErrHolidayInvalid,
+		},
+		{
+			name:        "Empty window",
+			holiday:     model.PaymentHoliday{StartMonth: 1, Months: 0},
+			expectedErr: model.ErrHolidayInvalid,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			holiday := tc.holiday
+			request := model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(5000000),
+				InitialPayment: decimal.NewFromInt(1000000),
+				Months:         240,
+				Program:        model.ProgramRequest{Code: "salary"},
+				Holiday:        &holiday,
+			}
+
+			if _, err := calculator.Calculate(request, baseTime); err != tc.expectedErr {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCalculate_PaymentDates(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	date := func(s string) *model.Date {
+		parsed, err := time.Parse(DateFormat, s)
+		if err != nil {
+			t.Fatalf("Invalid test date %s: %v", s, err)
+		}
+		return &model.Date{Time: parsed}
+	}
+
+	tests := []struct {
+		name         string
+		baseTime     time.Time
+		contract     *model.Date
+		firstPayment *model.Date
+		paymentDay   int
+		months       int
+		expected     string
+	}{
+		{
+			name:     "Contract date overrides the current date",
+			baseTime: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			contract: date("2024-02-18"),
+			months:   240,
+			expected: "2044-02-18",
+		},
+		{
+			name:     "Current date is taken in the caller timezone",
+			baseTime: time.Date(2024, 2, 18, 23, 30, 0, 0, time.FixedZone("MSK", 3*60*60)),
+			months:   12,
+			expected: "2025-02-18",
+		},
+		{
+			name:     "End of month is clamped to February",
+			contract: date("2024-01-31"),
+			months:   1,
+			expected: "2024-02-29",
+		},
+		{
+			name:     "End of month anchor is kept after February",
+			contract: date("2024-01-31"),
+			months:   2,
+			expected: "2024-03-31",
+		},
+		{
+			name:       "Payment day anchors all payments",
+			contract:   date("2024-02-18"),
+			paymentDay: 5,
+			months:     12,
+			expected:   "2025-02-05",
+		},
+		{
+			name:         "First payment date takes its day as the anchor",
+			contract:     date("2024-02-18"),
+			firstPayment: date("2024-03-30"),
+			months:       12,
+			expected:     "2025-02-28",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := model.ExecuteRequest{
+				ObjectCost:       decimal.NewFromInt(5000000),
+				InitialPayment:   decimal.NewFromInt(1000000),
+				Months:           tc.months,
+				Program:          model.ProgramRequest{Code: "salary"},
+				ContractDate:     tc.contract,
+				FirstPaymentDate: tc.firstPayment,
+				PaymentDay:       tc.paymentDay,
+			}
+
+			result, err := calculator.Calculate(request, tc.baseTime)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.LastPaymentDate != tc.expected {
+				t.Errorf("Expected last payment date %v, got %v", tc.expected, result.LastPaymentDate)
+			}
+		})
+	}
+}
+
+func TestCalculate_PaymentDateErrors(t *testing.T) {
+	calculator := NewMortCalculator()
+	contract := &model.Date{Time: time.Date(2024, 2, 18, 0, 0, 0, 0, time.UTC)}
+
+	request := model.ExecuteRequest{
+		ObjectCost:       decimal.NewFromInt(5000000),
+		InitialPayment:   decimal.NewFromInt(1000000),
+		Months:           240,
+		Program:          model.ProgramRequest{Code: "salary"},
+		ContractDate:     contract,
+		FirstPaymentDate: contract,
+	}
+
+	if _, err := calculator.Calculate(request, time.Time{}); err != model.ErrFirstPaymentTooEarly {
+		t.Errorf("Expected error %v, got %v", model.ErrFirstPaymentTooEarly, err)
+	}
+
+	request.FirstPaymentDate = nil
+	request.PaymentDay = 32
+	if _, err := calculator.Calculate(request, time.Time{}); err != model.ErrPaymentDayInvalid {
+		t.Errorf("Expected error %v, got %v", model.ErrPaymentDayInvalid, err)
+	}
+}
+
+func TestCalculate_RateTiers(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	tests := []struct {
+		name            string
+		initialPayment  int64
+		program         model.ProgramRequest
+		expectedRate    decimal.Decimal
+		expectedMinimum decimal.Decimal
+	}{
+		{
+			name:            "Salary program below 30%",
+			initialPayment:  1499999,
+			program:         model.ProgramRequest{Code: "salary"},
+			expectedRate:    decimal.NewFromFloat(8.0),
+			expectedMinimum: decimal.NewFromInt(20),
+		},
+		{
+			name:            "Salary program at exactly 30%",
+			initialPayment:  1500000,
+			program:         model.ProgramRequest{Code: "salary"},
+			expectedRate:    decimal.NewFromFloat(7.5),
+			expectedMinimum: decimal.NewFromInt(30),
+		},
+		{
+			name:            "Military program above 30%",
+			initialPayment:  2500000,
+			program:         model.ProgramRequest{Code: "military"},
+			expectedRate:    decimal.NewFromFloat(8.5),
+			expectedMinimum: decimal.NewFromInt(30),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(5000000),
+				InitialPayment: decimal.NewFromInt(tc.initialPayment),
+				Months:         240,
+				Program:        tc.program,
+			}
+
+			result, err := calculator.Calculate(request, baseTime)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !result.Rate.Equal(tc.expectedRate) {
+				t.Errorf("Expected rate %v, got %v", tc.expectedRate, result.Rate)
+			}
+
+			if !result.RateTier.MinInitialPayment.Equal(tc.expectedMinimum) {
+				t.Errorf("Expected tier from %v%%, got %v%%", tc.expectedMinimum, result.RateTier.MinInitialPayment)
+			}
+		})
+	}
+}
+
+func TestCalculate_RateModifiers(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "base"},
+		Modifiers:      []string{"no_life_insurance", "salary_client", "e_registration", "salary_client"},
+	}
+
+	result, err := calculator.Calculate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// 10 + 1 - 0.3 - 0.1
+	expectedRate := decimal.NewFromFloat(10.6)
+	if !result.Rate.Equal(expectedRate) {
+		t.Errorf("Expected rate %v, got %v", expectedRate, result.Rate)
+	}
+
+	if !result.BaseRate.Equal(decimal.NewFromFloat(10.0)) {
+		t.Errorf("Expected base rate 10, got %v", result.BaseRate)
+	}
+
+	if len(result.Modifiers) != 3 {
+		t.Fatalf("Expected 3 applied modifiers, got %d", len(result.Modifiers))
+	}
+
+	// The salary program has no salary client discount in its catalogue
+	request.Program = model.ProgramRequest{Code: "salary"}
+	if _, err := calculator.Calculate(request, baseTime); !errors.Is(err, model.ErrUnknownModifier) {
+		t.Errorf("Expected error %v, got %v", model.ErrUnknownModifier, err)
+	}
+}
+
+func TestCalculate_MilitaryContributions(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+	calculator.SetMilitaryContributions(map[int]decimal.Decimal{
+		2024: decimal.NewFromInt(360000),
+	})
+
+	request := model.ExecuteRequest{
+		ObjectCost:          decimal.NewFromInt(5000000),
+		InitialPayment:      decimal.NewFromInt(1000000),
+		Months:              240,
+		Program:             model.ProgramRequest{Code: "military"},
+		ServicemanBirthDate: &model.Date{Time: time.Date(1994, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	result, err := calculator.Calculate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	summary := result.Military
+	if summary == nil {
+		t.Fatal("Expected military summary")
+	}
+
+	if summary.ContributionsEndDate != "2039-06-01" {
+		t.Errorf("Expected contributions end date 2039-06-01, got %v", summary.ContributionsEndDate)
+	}
+
+	// 360000 / 12 of the 35989 payment is covered by the state, for the ten
+	// payments from March to December
+	first := summary.Years[0]
+	if first.Year != 2024 || !first.StatePayment.Equal(decimal.NewFromInt(300000)) || !first.OwnPayment.Equal(decimal.NewFromInt(59890)) {
+		t.Errorf("Expected 300000 + 59890 split in 2024, got %v + %v in %d", first.StatePayment, first.OwnPayment, first.Year)
+	}
+
+	// The age limit is reached in June 2039: the state pays from January to May
+	var limitYear model.MilitaryYear
+	for _, year := range summary.Years {
+		if year.Year == 2039 {
+			limitYear = year
+		}
+	}
+	if !limitYear.StatePayment.Equal(decimal.NewFromInt(150000)) || !limitYear.OwnPayment.Equal(decimal.NewFromInt(281868)) {
+		t.Errorf("Expected 150000 + 281868 split in 2039, got %v + %v", limitYear.StatePayment, limitYear.OwnPayment)
+	}
+
+	// The years add up to the totals
+	stateYears, ownYears := DecimalZero, DecimalZero
+	for _, year := range summary.Years {
+		stateYears = stateYears.Add(year.StatePayment)
+		ownYears = ownYears.Add(year.OwnPayment)
+	}
+	if !stateYears.Round(0).Equal(summary.StateTotal) || !ownYears.Round(0).Equal(summary.OwnTotal) {
+		t.Errorf("Expected the years to add up to %v + %v, got %v + %v", summary.StateTotal, summary.OwnTotal, stateYears, ownYears)
+	}
+
+	// The serviceman pays the whole payment after turning 45
+	last := summary.Years[len(summary.Years)-1]
+	if !last.StatePayment.IsZero() {
+		t.Errorf("Expected no state payment in %d, got %v", last.Year, last.StatePayment)
+	}
+
+	if summary.PayoffDate != result.LastPaymentDate {
+		t.Errorf("Expected payoff on %v, got %v", result.LastPaymentDate, summary.PayoffDate)
+	}
+
+	// The overpayment is based on the rounded payment, so allow a ruble per month
+	paid := summary.StateTotal.Add(summary.OwnTotal)
+	expectedPaid := request.ObjectCost.Sub(request.InitialPayment).Add(result.Overpayment)
+	if paid.Sub(expectedPaid).Abs().GreaterThan(decimal.NewFromInt(int64(request.Months))) {
+		t.Errorf("Expected %v paid in total, got %v", expectedPaid, paid)
+	}
+}
+
+func TestCalculate_MilitaryEarlyPayoff(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	// Contributions exceed the regular payment and repay the loan early
+	calculator.SetMilitaryContributions(map[int]decimal.Decimal{
+		2024: decimal.NewFromInt(600000),
+	})
+
+	request := model.ExecuteRequest{
+		ObjectCost:          decimal.NewFromInt(5000000),
+		InitialPayment:      decimal.NewFromInt(1000000),
+		Months:              240,
+		Program:             model.ProgramRequest{Code: "military"},
+		ServicemanBirthDate: &model.Date{Time: time.Date(1994, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	result, err := calculator.Calculate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Military.PayoffDate >= "2039-06-01" {
+		t.Errorf("Expected payoff before the contributions end, got %v", result.Military.PayoffDate)
+	}
+
+	if !result.Military.OwnTotal.IsZero() {
+		t.Errorf("Expected no own payments, got %v", result.Military.OwnTotal)
+	}
+
+	request.ServicemanBirthDate = &model.Date{Time: time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if _, err := calculator.Calculate(request, baseTime); err != model.ErrServicemanTooOld {
+		t.Errorf("Expected error %v, got %v", model.ErrServicemanTooOld, err)
+	}
+
+	request.Program = model.ProgramRequest{Code: "base"}
+	if _, err := calculator.Calculate(request, baseTime); err != model.ErrServicemanNotMilitary {
+		t.Errorf("Expected error %v, got %v", model.ErrServicemanNotMilitary, err)
+	}
+}
+
+func TestCalculate_StatePrograms(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	family := &model.Applicant{Age: 32, ChildrenAges: []int{3}, PropertyType: model.PropertyNewBuild}
+
+	tests := []struct {
+		name         string
+		program      model.ProgramRequest
+		applicant    *model.Applicant
+		objectCost   int64
+		expectedRate decimal.Decimal
+		expectedErr  error
+	}{
+		{
+			name:         "Family program",
+			program:      model.ProgramRequest{Code: "family"},
+			applicant:    family,
+			objectCost:   5000000,
+			expectedRate: decimal.NewFromFloat(6.0),
+		},
+		{
+			name:    "IT program",
+			program: model.ProgramRequest{Code: "it"},
+			applicant: &model.Applicant{
+				Age: 28, EmployerAccredited: true, PropertyType: model.PropertyNewBuild,
+			},
+			objectCost:   5000000,
+			expectedRate: decimal.NewFromFloat(6.0),
+		},
+		{
+			name:    "Far East program",
+			program: model.ProgramRequest{Code: "far_east"},
+			applicant: &model.Applicant{
+				Age: 30, Region: "primorsky", PropertyType: model.PropertyHouse,
+			},
+			objectCost:   5000000,
+			expectedRate: decimal.NewFromFloat(2.0),
+		},
+		{
+			name:        "Applicant is required",
+			program:     model.ProgramRequest{Code: "family"},
+			objectCost:  5000000,
+			expectedErr: model.ErrApplicantRequired,
+		},
+		{
+			name:        "Loan above the program cap",
+			program:     model.ProgramRequest{Code: "family"},
+			applicant:   family,
+			objectCost:  10000000,
+			expectedErr: model.ErrLimitViolated,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(tc.objectCost),
+				InitialPayment: decimal.NewFromInt(tc.objectCost / 5),
+				Months:         240,
+				Program:        tc.program,
+				Applicant:      tc.applicant,
+			}
+
+			result, err := calculator.Calculate(request, baseTime)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+
+			if tc.expectedErr == nil && !result.Rate.Equal(tc.expectedRate) {
+				t.Errorf("Expected rate %v, got %v", tc.expectedRate, result.Rate)
+			}
+		})
+	}
+}
+
+func TestCalculate_NotEligible(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "family"},
+		Applicant:      &model.Applicant{Age: 40, ChildrenAges: []int{10}, PropertyType: model.PropertySecondary},
+	}
+
+	_, err := calculator.Calculate(request, baseTime)
+
+	var notEligible *model.NotEligibleError
+	if !errors.As(err, &notEligible) {
+		t.Fatalf("Expected not eligible error, got %v", err)
+	}
+
+	if len(notEligible.Failed) != 2 {
+		t.Errorf("Expected 2 failed conditions, got %v", notEligible.Failed)
+	}
+}
+
+func TestCheckEligibility(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	results := calculator.CheckEligibility(model.Applicant{
+		Age:                30,
+		ChildrenAges:       []int{12, 15},
+		EmployerAccredited: true,
+		Region:             "moscow",
+		PropertyType:       model.PropertyNewBuild,
+	}, nil)
+
+	expected := map[string]bool{
+		"salary":   true,
+		"military": true,
+		"base":     true,
+		"family":   true,
+		"it":       true,
+		"far_east": false,
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+
+	for _, result := range results {
+		if result.Eligible != expected[result.Program] {
+			t.Errorf("Expected %s eligibility %v, got %v: %+v", result.Program, expected[result.Program], result.Eligible, result.Checks)
+		}
+	}
+}
+
+// TestCheckEligibility_NegativeChildAge checks that negative ages do not count as children
+func TestCheckEligibility_NegativeChildAge(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	checked := false
+	for _, result := range calculator.CheckEligibility(model.Applicant{Age: 30, ChildrenAges: []int{-1}}, nil) {
+		for _, check := range result.Checks {
+			if check.Rule != "children" {
+				continue
+			}
+			checked = true
+			if check.Passed {
+				t.Errorf("Expected a negative child age to fail the children rule of %s, got %+v", result.Program, check)
+			}
+		}
+	}
+	if !checked {
+		t.Error("Expected a program with the children rule")
+	}
+}
+
+// TestCheckEligibility_Reasons checks that failed rules explain the applicant values
+func TestCheckEligibility_Reasons(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	results := calculator.CheckEligibility(model.Applicant{
+		Age:          52,
+		Region:       "moscow",
+		PropertyType: model.PropertySecondary,
+	}, nil)
+
+	reasons := make(map[string]string)
+	for _, result := range results {
+		if result.Program != "it" {
+			continue
+		}
+		for _, check := range result.Checks {
+			if check.Passed == (check.Reason != "") {
+				t.Errorf("Expected a reason for failed checks only, got %+v", check)
+			}
+			reasons[check.Rule] = check.Reason
+		}
+	}
+
+	expected := map[string]string{
+		"accredited_employer": "employer_accredited is false",
+		"it_age":              "age is 52, expected <= 50",
+		"new_build":           `property_type is "secondary", expected == "new_build"`,
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("Expected reasons %q, got %q", expected, reasons)
+	}
+}
+
+// TestCreateProgram_Rules checks programs with their own rule expressions
+func TestCreateProgram_Rules(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	definition := BaseProgram.Definition()
+	definition.Code = "young_family"
+	definition.Eligibility = []string{"new_build"}
+	definition.Rules = []model.EligibilityRuleDefinition{{
+		Name:       "young_parents",
+		Condition:  "applicant is under 35 with a child",
+		Expression: "age < 35 and count(children_ages < 18) >= 1",
+	}}
+	if _, err := calculator.CreateProgram(definition); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	catalog := calculator.Catalog()
+	saved := catalog.Programs[len(catalog.Programs)-1]
+	if !reflect.DeepEqual(saved.Eligibility, definition.Eligibility) || !reflect.DeepEqual(saved.Rules, definition.Rules) {
+		t.Errorf("Expected the rules to be kept as defined, got %v and %+v", saved.Eligibility, saved.Rules)
+	}
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "young_family"},
+		Applicant:      &model.Applicant{Age: 36, ChildrenAges: []int{4}, PropertyType: model.PropertyNewBuild},
+	}
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+
+	_, err := calculator.Calculate(request, baseTime)
+	var notEligible *model.NotEligibleError
+	if !errors.As(err, &notEligible) || len(notEligible.Failed) != 1 ||
+		notEligible.Failed[0] != "applicant is under 35 with a child (age is 36, expected < 35)" {
+		t.Fatalf("Expected the age rule to fail with its reason, got %v", err)
+	}
+
+	request.Applicant.Age = 30
+	if _, err = calculator.Calculate(request, baseTime); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	invalid := []model.EligibilityRuleDefinition{
+		{Name: "salary", Expression: "income > 100000"},
+		{Name: "age", Expression: "age >"},
+		{Expression: "age > 18"},
+	}
+	for _, rule := range invalid {
+		definition.Code = "invalid"
+		definition.Rules = []model.EligibilityRuleDefinition{rule}
+		if _, err := calculator.CreateProgram(definition); !errors.Is(err, ErrInvalidProgram) {
+			t.Errorf("Expected error %v for %+v, got %v", ErrInvalidProgram, rule, err)
+		}
+	}
+}
+
+// TestCalculate_Features checks programs rolled out with a feature flag and the flags changing the calculation
+func TestCalculate_Features(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	definition := BaseProgram.Definition()
+	definition.Code = "base_v2"
+	definition.Feature = "new_base"
+	if _, err := calculator.CreateProgram(definition); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "base_v2"},
+	}
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+
+	if _, err := calculator.Calculate(request, baseTime); !errors.Is(err, ErrUnknownProgram) {
+		t.Errorf("Expected error %v without the feature, got %v", ErrUnknownProgram, err)
+	}
+
+	request.Features = model.Features{"new_base"}
+	if _, err := calculator.Calculate(request, baseTime); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	offered := func(features model.Features) bool {
+		for _, result := range calculator.CheckEligibility(model.Applicant{}, features) {
+			if result.Program == "base_v2" {
+				return true
+			}
+		}
+		return false
+	}
+	if offered(nil) || !offered(model.Features{"new_base"}) {
+		t.Error("Expected base_v2 to be offered with the feature only")
+	}
+
+	// A payment of exactly half a ruble shows the rounding method
+	payment := decimal.NewFromFloat(2.5)
+	if rounded := annuityPayment(DecimalOne, DecimalZero, payment, false, false, nil); !rounded.Equal(decimal.NewFromInt(3)) {
+		t.Errorf("Expected 3 rounded half away from zero, got %s", rounded)
+	}
+	if rounded := annuityPayment(DecimalOne, DecimalZero, payment, false, true, nil); !rounded.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("Expected 2 with bankers rounding, got %s", rounded)
+	}
+}
+
+func TestCalculate_Limits(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	family := &model.Applicant{Age: 32, ChildrenAges: []int{3}, PropertyType: model.PropertyNewBuild}
+
+	tests := []struct {
+		name          string
+		objectCost    int64
+		months        int
+		program       model.ProgramRequest
+		region        string
+		expectedError string
+	}{
+		{
+			name:       "Raised cap in Moscow",
+			objectCost: 15000000,
+			months:     240,
+			program:    model.ProgramRequest{Code: "family"},
+			region:     "moscow",
+		},
+		{
+			name:          "Regional cap exceeded",
+			objectCost:    16000000,
+			months:        240,
+			program:       model.ProgramRequest{Code: "family"},
+			region:        "moscow",
+			expectedError: "loan sum of 12800000 rub violates the loan sum limit of the family program in region moscow: allowed 300000..12000000 rub",
+		},
+		{
+			name:          "Default cap outside the capital regions",
+			objectCost:    10000000,
+			months:        240,
+			program:       model.ProgramRequest{Code: "family"},
+			region:        "tver_oblast",
+			expectedError: "loan sum of 8000000 rub violates the loan sum limit of the family program: allowed 300000..6000000 rub",
+		},
+		{
+			name:          "Term too long",
+			objectCost:    5000000,
+			months:        420,
+			program:       model.ProgramRequest{Code: "family"},
+			expectedError: "term of 420 months violates the term limit of the family program: allowed 12..360 months",
+		},
+		{
+			name:          "Loan too small",
+			objectCost:    300000,
+			months:        120,
+			program:       model.ProgramRequest{Code: "family"},
+			expectedError: "loan sum of 240000 rub violates the loan sum limit of the family program: allowed 300000..6000000 rub",
+		},
+		{
+			name:       "Legacy programs are not limited",
+			objectCost: 300000,
+			months:     6,
+			program:    model.ProgramRequest{Code: "base"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(tc.objectCost),
+				InitialPayment: decimal.NewFromInt(tc.objectCost / 5),
+				Months:         tc.months,
+				Program:        tc.program,
+				Applicant:      family,
+				Region:         tc.region,
+			}
+
+			_, err := calculator.Calculate(request, baseTime)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, model.ErrLimitViolated) || err.Error() != tc.expectedError {
+				t.Errorf("Expected error %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestSetLimits(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	if err := calculator.SetLimits("base", Limits{MaxMonths: 120}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         180,
+		Program:        model.ProgramRequest{Code: "base"},
+	}
+
+	if _, err := calculator.Calculate(request, baseTime); !errors.Is(err, model.ErrLimitViolated) {
+		t.Errorf("Expected limit error, got %v", err)
+	}
+
+	// The defaults of other calculators are not affected
+	if _, err := NewMortCalculator().Calculate(request, baseTime); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := calculator.SetLimits("unknown", Limits{}); !errors.Is(err, ErrUnknownProgram) {
+		t.Errorf("Expected error %v, got %v", ErrUnknownProgram, err)
+	}
+}
+
+func TestCalculate_Frequencies(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	tests := []struct {
+		frequency       string
+		expectedPayment int64
+		expectedCount   int
+		expectedMonthly int64
+		expectedOver    int64
+		expectedDate    string
+	}{
+		{model.FrequencyWeekly, 7713, 1040, 33423, 4021520, "2044-01-24"},
+		// Accelerated: half of the monthly payment every 14 days
+		{model.FrequencyBiweekly, 16729, 434, 36246, 3246089, "2040-10-07"},
+		{model.FrequencyQuarterly, 100643, 80, 33548, 4051440, "2044-02-18"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.frequency, func(t *testing.T) {
+			request := model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(5000000),
+				InitialPayment: decimal.NewFromInt(1000000),
+				Months:         240,
+				Program:        model.ProgramRequest{Code: "salary"},
+				Frequency:      tc.frequency,
+			}
+
+			result, err := calculator.Calculate(request, baseTime)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.PeriodPayment == nil || !result.PeriodPayment.Equal(decimal.NewFromInt(tc.expectedPayment)) {
+				t.Errorf("Expected period payment %v, got %v", tc.expectedPayment, result.PeriodPayment)
+			}
+
+			if result.Payments != tc.expectedCount {
+				t.Errorf("Expected %d payments, got %d", tc.expectedCount, result.Payments)
+			}
+
+			if !result.MonthlyPayment.Equal(decimal.NewFromInt(tc.expectedMonthly)) {
+				t.Errorf("Expected monthly equivalent %v, got %v", tc.expectedMonthly, result.MonthlyPayment)
+			}
+
+			if !result.Overpayment.Equal(decimal.NewFromInt(tc.expectedOver)) {
+				t.Errorf("Expected overpayment %v, got %v", tc.expectedOver, result.Overpayment)
+			}
+
+			if result.LastPaymentDate != tc.expectedDate {
+				t.Errorf("Expected last payment date %v, got %v", tc.expectedDate, result.LastPaymentDate)
+			}
+		})
+	}
+}
+
+// TestCalculate_AcceleratedBiweekly checks that bi-weekly payments of half the
+// monthly payment repay the loan ahead of the term at a lower overpayment
+func TestCalculate_AcceleratedBiweekly(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+	}
+	monthly, err := calculator.Calculate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	request.Frequency = model.FrequencyBiweekly
+	biweekly, err := calculator.Calculate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !biweekly.PeriodPayment.Mul(decimal.NewFromInt(2)).Equal(monthly.MonthlyPayment) {
+		t.Errorf("Expected half of the monthly payment %s, got %s", monthly.MonthlyPayment, biweekly.PeriodPayment)
+	}
+	if biweekly.TermMonths != 201 {
+		t.Errorf("Expected the term shortened to 201 months, got %d", biweekly.TermMonths)
+	}
+	if biweekly.LastPaymentDate >= monthly.LastPaymentDate {
+		t.Errorf("Expected the loan repaid before %s, got %s", monthly.LastPaymentDate, biweekly.LastPaymentDate)
+	}
+	if !biweekly.Overpayment.LessThan(monthly.Overpayment) {
+		t.Errorf("Expected an overpayment below %s, got %s", monthly.Overpayment, biweekly.Overpayment)
+	}
+	if monthly.TermMonths != 0 {
+		t.Errorf("Expected no shortened term for monthly payments, got %d", monthly.TermMonths)
+	}
+}
+
+func TestCalculate_FrequencyErrors(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	tests := []struct {
+		name        string
+		frequency   string
+		months      int
+		holiday     *model.PaymentHoliday
+		expectedErr error
+	}{
+		{
+			name:        "Unknown frequency",
+			frequency:   "daily",
+			months:      240,
+			expectedErr: model.ErrFrequencyInvalid,
+		},
+		{
+			name:        "Term is not a whole number of quarters",
+			frequency:   model.FrequencyQuarterly,
+			months:      100,
+			expectedErr: model.ErrTermFrequency,
+		},
+		{
+			name:        "Holiday with weekly payments",
+			frequency:   model.FrequencyWeekly,
+			months:      240,
+			holiday:     &model.PaymentHoliday{StartMonth: 1, Months: 3},
+			expectedErr: model.ErrMonthlyOnly,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(5000000),
+				InitialPayment: decimal.NewFromInt(1000000),
+				Months:         tc.months,
+				Program:        model.ProgramRequest{Code: "salary"},
+				Frequency:      tc.frequency,
+				Holiday:        tc.holiday,
+			}
+
+			if _, err := calculator.Calculate(request, baseTime); err != tc.expectedErr {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCalculate_Compounding(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	tests := []struct {
+		name            string
+		compounding     string
+		annuityDue      bool
+		expectedPayment int64
+		expectedOver    int64
+		expectedDate    string
+	}{
+		{"Monthly compounding matches the default", model.CompoundingMonthly, false, 33458, 4029920, "2044-02-18"},
+		{"Semi-annual compounding", model.CompoundingSemiAnnual, false, 33134, 3952160, "2044-02-18"},
+		{"Effective annual rate", model.CompoundingAnnual, false, 32766, 3863840, "2044-02-18"},
+		{"Annuity-due", "", true, 33236, 3976640, "2044-01-18"},
+		{"Annuity-due with semi-annual compounding", model.CompoundingSemiAnnual, true, 32918, 3900320, "2044-01-18"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			request := model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(5000000),
+				InitialPayment: decimal.NewFromInt(1000000),
+				Months:         240,
+				Program:        model.ProgramRequest{Code: "salary"},
+				Compounding:    tc.compounding,
+				AnnuityDue:     tc.annuityDue,
+			}
+
+			result, err := calculator.Calculate(request, baseTime)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !result.MonthlyPayment.Equal(decimal.NewFromInt(tc.expectedPayment)) {
+				t.Errorf("Expected monthly payment %v, got %v", tc.expectedPayment, result.MonthlyPayment)
+			}
+
+			if !result.Overpayment.Equal(decimal.NewFromInt(tc.expectedOver)) {
+				t.Errorf("Expected overpayment %v, got %v", tc.expectedOver, result.Overpayment)
+			}
+
+			// The first annuity-due payment is made at signing, so the last one is a period earlier
+			if result.LastPaymentDate != tc.expectedDate {
+				t.Errorf("Expected last payment date %v, got %v", tc.expectedDate, result.LastPaymentDate)
+			}
+		})
+	}
+}
+
+func TestCalculate_CompoundingErrors(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+		Compounding:    "daily",
+	}
+
+	if _, err := calculator.Calculate(request, baseTime); err != model.ErrCompoundingInvalid {
+		t.Errorf("Expected error %v, got %v", model.ErrCompoundingInvalid, err)
+	}
+
+	request.Compounding = ""
+	request.AnnuityDue = true
+	request.Holiday = &model.PaymentHoliday{StartMonth: 1, Months: 3}
+	if _, err := calculator.Calculate(request, baseTime); err != model.ErrAnnuityDueConflict {
+		t.Errorf("Expected error %v, got %v", model.ErrAnnuityDueConflict, err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+		Modifiers:      []string{"e_registration"},
+	}
+
+	result, trace, err := calculator.Explain(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	steps := make(map[string]string, len(trace.Steps))
+	for _, step := range trace.Steps {
+		steps[step.Name] = step.Value
+	}
+
+	expected := map[string]string{
+		"program":                 "salary",
+		"base rate":               "8",
+		"modifier e_registration": "-0.1",
+		"rate":                    "7.9",
+		"loan sum":                "4000000",
+		"number of payments":      "240",
+		"rounded payment":         result.MonthlyPayment.String(),
+		"overpayment":             result.Overpayment.String(),
+		"last payment date":       "2044-02-18",
+	}
+
+	for name, value := range expected {
+		if steps[name] != value {
+			t.Errorf("Expected step %q = %s, got %q", name, value, steps[name])
+		}
+	}
+
+	for _, name := range []string{"period rate", "power", "annuity coefficient"} {
+		if _, ok := steps[name]; !ok {
+			t.Errorf("Expected step %q in the trace", name)
+		}
+	}
+
+	for _, check := range trace.Checks {
+		if !check.Passed {
+			t.Errorf("Expected check %q to pass", check.Name)
+		}
+	}
+
+	// The plain calculation gives the same result
+	plain, err := calculator.Calculate(request, baseTime)
+	if err != nil || !plain.MonthlyPayment.Equal(result.MonthlyPayment) {
+		t.Errorf("Expected monthly payment %v, got %v (%v)", result.MonthlyPayment, plain.MonthlyPayment, err)
+	}
+}
+
+func TestExplain_FailedCheck(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(500000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+	}
+
+	_, trace, err := calculator.Explain(request, baseTime)
+	if err != model.ErrInitialPaymentLow {
+		t.Fatalf("Expected error %v, got %v", model.ErrInitialPaymentLow, err)
+	}
+
+	last := trace.Checks[len(trace.Checks)-1]
+	if last.Passed || last.Value != "10" || last.Threshold != ">= 20" {
+		t.Errorf("Expected failed initial payment check 10 >= 20, got %+v", last)
+	}
+
+	if !strings.Contains(trace.String(), "[FAIL] initial payment, %: 10 (allowed >= 20)") {
+		t.Errorf("Expected the failed check in the text trace, got:\n%s", trace)
+	}
+}
+
+func TestImpliedRate(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ImpliedRateRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		MonthlyPayment: decimal.NewFromInt(33458), // salary program payment at 8%
+	}
+
+	result, err := calculator.ImpliedRate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The quoted payment is rounded to rubles, so the rate is 8% within that rounding
+	if result.ImpliedRate.Sub(decimal.NewFromInt(8)).Abs().GreaterThan(decimal.RequireFromString("0.001")) {
+		t.Errorf("Expected implied rate of about 8, got %s", result.ImpliedRate)
+	}
+	if len(result.Offers) != 0 {
+		t.Errorf("Expected no program to beat its own payment, got %+v", result.Offers)
+	}
+
+	request.MonthlyPayment = decimal.NewFromInt(36000)
+	result, err = calculator.ImpliedRate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []model.ProgramOffer{
+		{Program: "salary", Rate: decimal.NewFromInt(8), MonthlyPayment: decimal.NewFromInt(33458), MonthlySaving: decimal.NewFromInt(2542)},
+		{Program: "military", Rate: decimal.NewFromInt(9), MonthlyPayment: decimal.NewFromInt(35989), MonthlySaving: decimal.NewFromInt(11)},
+	}
+	if len(result.Offers) != len(expected) {
+		t.Fatalf("Expected %d offers, got %+v", len(expected), result.Offers)
+	}
+	for i, offer := range result.Offers {
+		if offer.Program != expected[i].Program || !offer.Rate.Equal(expected[i].Rate) ||
+			!offer.MonthlyPayment.Equal(expected[i].MonthlyPayment) || !offer.MonthlySaving.Equal(expected[i].MonthlySaving) {
+			t.Errorf("Offer %d: expected %+v, got %+v", i, expected[i], offer)
+		}
+	}
+}
+
+func TestImpliedRate_Errors(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	// Below loan / months even an interest-free loan is not repaid
+	_, err := calculator.ImpliedRate(model.ImpliedRateRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		MonthlyPayment: decimal.NewFromInt(16000),
+	}, baseTime)
+	if err != model.ErrQuotedPaymentLow {
+		t.Errorf("Expected error %v, got %v", model.ErrQuotedPaymentLow, err)
+	}
+
+	result, err := calculator.ImpliedRate(model.ImpliedRateRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         250,
+		MonthlyPayment: decimal.NewFromInt(16000),
+	}, baseTime)
+	if err != nil || !result.ImpliedRate.IsZero() {
+		t.Errorf("Expected zero implied rate, got %s, %v", result.ImpliedRate, err)
+	}
+}
+
+func TestSetPrograms(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	green := Program{
+		Code: "green",
+		Name: "Energy efficient home",
+		Tiers: []model.RateTier{
+			{MinInitialPayment: decimal.NewFromInt(15), Rate: decimal.NewFromFloat(7.0)},
+		},
+	}
+	if err := calculator.SetPrograms([]Program{BaseProgram, green}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	agg, err := calculator.Calculate(model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(750000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "green"},
+	}, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if agg.ProgramName != green.Name || !agg.Rate.Equal(decimal.NewFromInt(7)) {
+		t.Errorf("Expected %s at 7%%, got %s at %s", green.Name, agg.ProgramName, agg.Rate)
+	}
+
+	_, err = calculator.Calculate(model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+	}, baseTime)
+	if !errors.Is(err, ErrUnknownProgram) {
+		t.Errorf("Expected error %v for a program removed from the catalog, got %v", ErrUnknownProgram, err)
+	}
+}
+
+func TestSetPrograms_Invalid(t *testing.T) {
+	tier := func(minInitial, rate int64) model.RateTier {
+		return model.RateTier{MinInitialPayment: decimal.NewFromInt(minInitial), Rate: decimal.NewFromInt(rate)}
+	}
+
+	tests := []struct {
+		name     string
+		programs []Program
+	}{
+		{name: "No code", programs: []Program{{Tiers: []model.RateTier{tier(20, 8)}}}},
+		{name: "No tiers", programs: []Program{{Code: "empty"}}},
+		{name: "Zero rate", programs: []Program{{Code: "free", Tiers: []model.RateTier{tier(20, 0)}}}},
+		{name: "Initial payment of 100%", programs: []Program{{Code: "cash", Tiers: []model.RateTier{tier(100, 8)}}}},
+		{name: "Unsorted tiers", programs: []Program{{Code: "unsorted", Tiers: []model.RateTier{tier(30, 7), tier(20, 8)}}}},
+		{name: "Duplicate code", programs: []Program{BaseProgram, BaseProgram}},
+		{name: "Rate period without date", programs: []Program{{Code: "undated", Tiers: []model.RateTier{tier(20, 8)},
+			Rates: []model.RatePeriod{{Tiers: []model.RateTier{tier(20, 7)}}}}}},
+		{name: "Unsorted rate periods", programs: []Program{{Code: "unsorted", Tiers: []model.RateTier{tier(20, 8)},
+			Rates: []model.RatePeriod{
+				{EffectiveFrom: model.NewDate(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)), Tiers: []model.RateTier{tier(20, 7)}},
+				{EffectiveFrom: model.NewDate(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)), Tiers: []model.RateTier{tier(20, 6)}},
+			}}}},
+		{name: "Invalid rate period", programs: []Program{{Code: "invalid", Tiers: []model.RateTier{tier(20, 8)},
+			Rates: []model.RatePeriod{{EffectiveFrom: model.NewDate(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))}}}}},
+		{name: "Discount to a zero rate", programs: []Program{{Code: "discounted",
+			Tiers:     []model.RateTier{{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(0.3)}},
+			Modifiers: []model.RateModifier{ModifierSalaryClient}}}},
+		{name: "Discount to a negative rate in a rate period", programs: []Program{{Code: "discounted",
+			Tiers:     []model.RateTier{tier(20, 8)},
+			Modifiers: []model.RateModifier{ModifierSalaryClient},
+			Rates: []model.RatePeriod{{EffectiveFrom: model.NewDate(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)),
+				Tiers: []model.RateTier{{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(0.2)}}}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calculator := NewMortCalculator()
+			if err := calculator.SetPrograms(tt.programs); !errors.Is(err, ErrInvalidProgram) {
+				t.Errorf("Expected error %v, got %v", ErrInvalidProgram, err)
+			}
+			if calculator.Catalog().Version != 1 {
+				t.Errorf("Expected the catalog to be left unchanged")
+			}
+		})
+	}
+}
+
+// TestGetProgramRate_AsOf checks that the rate valid on the as-of date is used
+func TestGetProgramRate_AsOf(t *testing.T) {
+	date := func(year int, month time.Month, day int) model.Date {
+		return model.NewDate(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+	}
+
+	calculator := NewMortCalculator()
+	_, err := calculator.ScheduleRates(SalaryProgram.Code, model.RatePeriod{
+		EffectiveFrom: date(2024, 3, 1),
+		Tiers: []model.RateTier{
+			{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(9.0)},
+			{MinInitialPayment: decimal.NewFromInt(30), Rate: decimal.NewFromFloat(8.5)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The request time is in Moscow, already March 1 there
+	moscow := time.FixedZone("MSK", 3*60*60)
+	baseTime := time.Date(2024, 2, 29, 22, 0, 0, 0, time.UTC).In(moscow)
+
+	tests := []struct {
+		name          string
+		asOf          *model.Date
+		rate          string
+		effectiveFrom string
+	}{
+		{name: "Before the change", asOf: &model.Date{Time: date(2024, 2, 29).Time}, rate: "8"},
+		{name: "On the effective date", asOf: &model.Date{Time: date(2024, 3, 1).Time}, rate: "9", effectiveFrom: "2024-03-01"},
+		{name: "Current date", rate: "9", effectiveFrom: "2024-03-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg, err := calculator.Calculate(model.ExecuteRequest{
+				ObjectCost:     decimal.NewFromInt(5000000),
+				InitialPayment: decimal.NewFromInt(1000000),
+				Months:         240,
+				Program:        model.ProgramRequest{Code: "salary"},
+				AsOf:           tt.asOf,
+			}, baseTime)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if agg.Rate.String() != tt.rate {
+				t.Errorf("Expected rate %s, got %s", tt.rate, agg.Rate)
+			}
+			if agg.RateEffectiveFrom != tt.effectiveFrom {
+				t.Errorf("Expected rate effective from %q, got %q", tt.effectiveFrom, agg.RateEffectiveFrom)
+			}
+		})
+	}
+
+	// The as-of date is the default contract date of a reproduced quote
+	agg, err := calculator.Calculate(model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         12,
+		Program:        model.ProgramRequest{Code: "salary"},
+		AsOf:           &model.Date{Time: date(2024, 2, 14).Time},
+	}, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if agg.AsOf != "2024-02-14" || agg.LastPaymentDate != "2025-02-14" {
+		t.Errorf("Expected a quote as of 2024-02-14 ending on 2025-02-14, got %s and %s", agg.AsOf, agg.LastPaymentDate)
+	}
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+var (
+	// Error for creating a program with a code already in the catalog
+	ErrProgramExists = errors.New("mortgage program already exists")
+
+	// Error for selecting a deactivated program
+	ErrProgramInactive = errors.New("mortgage program is not offered")
+)
+
+// CatalogStore persists the program catalog between restarts
+type CatalogStore interface {
+	// Load returns the saved catalog, or a catalog of version 0 when nothing was saved yet
+	Load() (model.Catalog, error)
+	Save(catalog model.Catalog) error
+}
+
+// ProgramAdmin manages the program catalog at runtime. Every change is validated,
+// persisted and produces a new catalog version.
+type ProgramAdmin interface {
+	Catalog() model.Catalog
+	CreateProgram(definition model.ProgramDefinition) (model.Catalog, error)
+	UpdateProgram(code string, definition model.ProgramDefinition) (model.Catalog, error)
+	SetProgramActive(code string, active bool) (model.Catalog, error)
+	ScheduleRates(code string, period model.RatePeriod) (model.Catalog, error)
+}
+
+// catalog is an immutable version of the program catalog. A change builds a new
+// version that replaces the current one atomically, so every calculation uses
+// a single consistent version from start to end.
+type catalog struct {
+	version      int
+	updatedAt    time.Time
+	programs     []Program
+	coefficients *coefficientTable
+}
+
+// newCatalog creates a catalog version, previous is the table of the version
+// it replaces or nil
+func newCatalog(version int, updatedAt time.Time, programs []Program, previous *coefficientTable) *catalog {
+	copied := make([]Program, len(programs))
+	copy(copied, programs)
+
+	return &catalog{
+		version:      version,
+		updatedAt:    updatedAt,
+		programs:     copied,
+		coefficients: buildCoefficientTable(copied, previous),
+	}
+}
+
+// program finds an offered program by its code. Programs behind a feature
+// flag not enabled for the request are unknown to it.
+func (c *catalog) program(code string, features model.Features) (Program, error) {
+	if code == "" {
+		return Program{}, ErrNoProgramSelected
+	}
+
+	for _, p := range c.programs {
+		if p.Code != code || !p.releasedTo(features) {
+			continue
+		}
+		if p.Inactive {
+			return Program{}, fmt.Errorf("%w: %s", ErrProgramInactive, code)
+		}
+		return p, nil
+	}
+
+	return Program{}, fmt.Errorf("%w: %s", ErrUnknownProgram, code)
+}
+
+// active returns the programs currently offered to a request with the features
+func (c *catalog) active(features model.Features) []Program {
+	programs := make([]Program, 0, len(c.programs))
+	for _, p := range c.programs {
+		if !p.Inactive && p.releasedTo(features) {
+			programs = append(programs, p)
+		}
+	}
+
+	return programs
+}
+
+// releasedTo reports whether the program is offered to a request with the features
+func (p Program) releasedTo(features model.Features) bool {
+	return p.Feature == "" || features.Enabled(p.Feature)
+}
+
+func (c *catalog) model() model.Catalog {
+	definitions := make([]model.ProgramDefinition, len(c.programs))
+	for i, p := range c.programs {
+		definitions[i] = p.Definition()
+	}
+
+	return model.Catalog{Version: c.version, UpdatedAt: c.updatedAt, Programs: definitions}
+}
+
+// validatePrograms checks every program and the uniqueness of the codes
+func validatePrograms(programs []Program) error {
+	seen := make(map[string]bool, len(programs))
+	for _, p := range programs {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		if seen[p.Code] {
+			return fmt.Errorf("%w: duplicate code %s", ErrInvalidProgram, p.Code)
+		}
+		seen[p.Code] = true
+	}
+
+	return nil
+}
+
+// Definition returns the catalog representation of the program
+func (p Program) Definition() model.ProgramDefinition {
+	definition := model.ProgramDefinition{
+		Code:     p.Code,
+		Name:     p.Name,
+		Lender:   p.Lender,
+		IssueFee: p.IssueFee,
+		Feature:  p.Feature,
+		Active:   !p.Inactive,
+		Tiers:    p.Tiers,
+		Rates:    p.Rates,
+		Limits: model.ProgramLimits{
+			MinLoan:   p.Limits.MinLoan,
+			MaxLoan:   p.Limits.MaxLoan,
+			MinMonths: p.Limits.MinMonths,
+			MaxMonths: p.Limits.MaxMonths,
+			Regions:   p.Limits.RegionMaxLoan,
+		},
+	}
+
+	for _, m := range p.Modifiers {
+		definition.Modifiers = append(definition.Modifiers, m.Code)
+	}
+	for _, rule := range p.Rules {
+		if builtin, ok := EligibilityRules[rule.Name]; ok && builtin.Expression.String() == rule.Expression.String() {
+			definition.Eligibility = append(definition.Eligibility, rule.Name)
+			continue
+		}
+		definition.Rules = append(definition.Rules, model.EligibilityRuleDefinition{
+			Name:       rule.Name,
+			Condition:  rule.Condition,
+			Expression: rule.Expression.String(),
+		})
+	}
+
+	return definition
+}
+
+// ProgramFromDefinition builds a program resolving the modifier codes and rule
+// names of the definition against the catalogues
+func ProgramFromDefinition(definition model.ProgramDefinition) (Program, error) {
+	program := Program{
+		Code:     definition.Code,
+		Name:     definition.Name,
+		Lender:   definition.Lender,
+		IssueFee: definition.IssueFee,
+		Feature:  definition.Feature,
+		Inactive: !definition.Active,
+		Tiers:    definition.Tiers,
+		Rates:    definition.Rates,
+		Limits: Limits{
+			MinLoan:       definition.Limits.MinLoan,
+			MaxLoan:       definition.Limits.MaxLoan,
+			MinMonths:     definition.Limits.MinMonths,
+			MaxMonths:     definition.Limits.MaxMonths,
+			RegionMaxLoan: definition.Limits.Regions,
+		},
+	}
+
+	for _, code := range definition.Modifiers {
+		modifier, ok := RateModifiers[code]
+		if !ok {
+			return Program{}, fmt.Errorf("%w: %s: %w: %s", ErrInvalidProgram, definition.Code, model.ErrUnknownModifier, code)
+		}
+		program.Modifiers = append(program.Modifiers, modifier)
+	}
+
+	for _, name := range definition.Eligibility {
+		rule, ok := EligibilityRules[name]
+		if !ok {
+			return Program{}, fmt.Errorf("%w: %s: unknown eligibility rule %s", ErrInvalidProgram, definition.Code, name)
+		}
+		program.Rules = append(program.Rules, rule)
+	}
+
+	for _, r := range definition.Rules {
+		rule, err := NewEligibilityRule(r.Name, r.Condition, r.Expression)
+		if err != nil {
+			return Program{}, fmt.Errorf("%w: %s: %w", ErrInvalidProgram, definition.Code, err)
+		}
+		program.Rules = append(program.Rules, rule)
+	}
+
+	if err := program.validate(); err != nil {
+		return Program{}, err
+	}
+
+	return program, nil
+}
+
+// UseStore makes the calculator persist catalog changes to the store. A catalog
+// saved earlier replaces the current one, so runtime changes survive restarts.
+func (c *MortCalculator) UseStore(store CatalogStore) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	saved, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	if saved.Version == 0 {
+		c.store = store
+		return nil
+	}
+
+	programs := make([]Program, 0, len(saved.Programs))
+	for _, definition := range saved.Programs {
+		program, err := ProgramFromDefinition(definition)
+		if err != nil {
+			return err
+		}
+		programs = append(programs, program)
+	}
+
+	if err = validatePrograms(programs); err != nil {
+		return err
+	}
+
+	c.catalog.Store(newCatalog(saved.Version, saved.UpdatedAt, programs, c.current().coefficients))
+	c.store = store
+
+	return nil
+}
+
+// HasSavedCatalog reports whether a catalog was saved to the store. A saved
+// catalog takes precedence over the configured programs.
+func (c *MortCalculator) HasSavedCatalog() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.store == nil {
+		return false, nil
+	}
+
+	saved, err := c.store.Load()
+	if err != nil {
+		return false, err
+	}
+
+	return saved.Version > 0, nil
+}
+
+// Catalog returns the current catalog version, deactivated programs included
+func (c *MortCalculator) Catalog() model.Catalog {
+	return c.current().model()
+}
+
+// CreateProgram adds a program to the catalog
+func (c *MortCalculator) CreateProgram(definition model.ProgramDefinition) (model.Catalog, error) {
+	program, err := ProgramFromDefinition(definition)
+	if err != nil {
+		return model.Catalog{}, err
+	}
+
+	return c.change(true, func(programs []Program) ([]Program, error) {
+		for _, p := range programs {
+			if p.Code == program.Code {
+				return nil, fmt.Errorf("%w: %s", ErrProgramExists, program.Code)
+			}
+		}
+
+		return append(programs, program), nil
+	})
+}
+
+// UpdateProgram replaces the definition of a program, keeping whether it is offered
+func (c *MortCalculator) UpdateProgram(code string, definition model.ProgramDefinition) (model.Catalog, error) {
+	if definition.Code == "" {
+		definition.Code = code
+	}
+	if definition.Code != code {
+		return model.Catalog{}, fmt.Errorf("%w: code %s cannot be changed to %s", ErrInvalidProgram, code, definition.Code)
+	}
+
+	program, err := ProgramFromDefinition(definition)
+	if err != nil {
+		return model.Catalog{}, err
+	}
+
+	return c.change(true, func(programs []Program) ([]Program, error) {
+		i, err := indexOf(programs, code)
+		if err != nil {
+			return nil, err
+		}
+
+		program.Inactive = programs[i].Inactive
+		programs[i] = program
+
+		return programs, nil
+	})
+}
+
+// SetProgramActive deactivates a program or offers it again. Deactivated
+// programs stay in the catalog so that earlier versions remain reproducible.
+func (c *MortCalculator) SetProgramActive(code string, active bool) (model.Catalog, error) {
+	return c.change(true, func(programs []Program) ([]Program, error) {
+		i, err := indexOf(programs, code)
+		if err != nil {
+			return nil, err
+		}
+
+		programs[i].Inactive = !active
+
+		return programs, nil
+	})
+}
+
+// ScheduleRates adds a rate table effective from the period date, replacing
+// the table scheduled for the same date. Earlier periods are kept so that
+// quotes as of past dates can be reproduced.
+func (c *MortCalculator) ScheduleRates(code string, period model.RatePeriod) (model.Catalog, error) {
+	period.EffectiveFrom = model.NewDate(period.EffectiveFrom.Time)
+
+	return c.change(true, func(programs []Program) ([]Program, error) {
+		i, err := indexOf(programs, code)
+		if err != nil {
+			return nil, err
+		}
+
+		rates := make([]model.RatePeriod, 0, len(programs[i].Rates)+1)
+		for _, p := range programs[i].Rates {
+			if !p.EffectiveFrom.Equal(period.EffectiveFrom.Time) {
+				rates = append(rates, p)
+			}
+		}
+		rates = append(rates, period)
+		sort.SliceStable(rates, func(a, b int) bool {
+			return rates[a].EffectiveFrom.Before(rates[b].EffectiveFrom.Time)
+		})
+		programs[i].Rates = rates
+
+		return programs, nil
+	})
+}
+
+// change applies the change to a copy of the current programs and, when the
+// result is valid and persisted, publishes it as the next catalog version.
+// Changes that are not persisted are published only.
+func (c *MortCalculator) change(persist bool, apply func(programs []Program) ([]Program, error)) (model.Catalog, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := c.current()
+	programs := make([]Program, len(current.programs))
+	copy(programs, current.programs)
+
+	programs, err := apply(programs)
+	if err != nil {
+		return model.Catalog{}, err
+	}
+
+	if err = validatePrograms(programs); err != nil {
+		return model.Catalog{}, err
+	}
+
+	next := newCatalog(current.version+1, time.Now().UTC(), programs, current.coefficients)
+	if persist && c.store != nil {
+		if err = c.store.Save(next.model()); err != nil {
+			return model.Catalog{}, fmt.Errorf("saving catalog: %w", err)
+		}
+	}
+
+	c.catalog.Store(next)
+
+	return next.model(), nil
+}
+
+func indexOf(programs []Program, code string) (int, error) {
+	for i, p := range programs {
+		if p.Code == code {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrUnknownProgram, code)
+}
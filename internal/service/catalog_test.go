@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// memoryStore keeps the saved catalog in memory and can fail on save
+type memoryStore struct {
+	saved model.Catalog
+	err   error
+}
+
+func (s *memoryStore) Load() (model.Catalog, error) {
+	return s.saved, nil
+}
+
+func (s *memoryStore) Save(catalog model.Catalog) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.saved = catalog
+
+	return nil
+}
+
+// TestCatalog_Changes checks that every change is versioned and persisted
+func TestCatalog_Changes(t *testing.T) {
+	calculator := NewMortCalculator()
+	store := &memoryStore{}
+	if err := calculator.UseStore(store); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	definition := BaseProgram.Definition()
+	definition.Code = "promo"
+	definition.Name = "Promo"
+
+	catalog, err := calculator.CreateProgram(definition)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if catalog.Version != 2 || store.saved.Version != 2 {
+		t.Errorf("Expected version 2 to be published and saved, got %d and %d", catalog.Version, store.saved.Version)
+	}
+
+	if _, err = calculator.SetProgramActive("promo", false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Updating a deactivated program keeps it deactivated
+	definition.Active = true
+	definition.Tiers = []model.RateTier{{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(5.5)}}
+	catalog, err = calculator.UpdateProgram("promo", definition)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if catalog.Version != 4 || catalog.Programs[len(catalog.Programs)-1].Active {
+		t.Errorf("Expected an inactive program in version 4, got %+v", catalog)
+	}
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "promo"},
+	}
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	if _, err = calculator.Calculate(request, baseTime); !errors.Is(err, ErrProgramInactive) {
+		t.Errorf("Expected ErrProgramInactive, got %v", err)
+	}
+
+	// A restarted calculator continues from the saved catalog
+	restarted := NewMortCalculator()
+	if err = restarted.UseStore(store); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = restarted.SetProgramActive("promo", true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	agg, err := restarted.Calculate(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if agg.CatalogVersion != 5 || !agg.Rate.Equal(decimal.NewFromFloat(5.5)) {
+		t.Errorf("Expected rate 5.5 from version 5, got %s from version %d", agg.Rate, agg.CatalogVersion)
+	}
+}
+
+// TestCatalog_SaveError checks that a change that cannot be saved is not published
+func TestCatalog_SaveError(t *testing.T) {
+	calculator := NewMortCalculator()
+	if err := calculator.UseStore(&memoryStore{err: errors.New("disk full")}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := calculator.SetProgramActive("salary", false); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	catalog := calculator.Catalog()
+	if catalog.Version != 1 || !catalog.Programs[0].Active {
+		t.Errorf("Expected the catalog to stay unchanged, got %+v", catalog)
+	}
+}
+
+// TestCreateProgram_DiscountedToZero checks that a program whose modifiers bring
+// the rate down to zero is rejected rather than tabulated
+func TestCreateProgram_DiscountedToZero(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	definition := BaseProgram.Definition()
+	definition.Code = "promo"
+	definition.Name = "Promo"
+	definition.Tiers = []model.RateTier{{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(0.3)}}
+	definition.Modifiers = []string{ModifierSalaryClient.Code}
+
+	if _, err := calculator.CreateProgram(definition); !errors.Is(err, ErrInvalidProgram) {
+		t.Errorf("Expected error %v, got %v", ErrInvalidProgram, err)
+	}
+	if calculator.Catalog().Version != 1 {
+		t.Errorf("Expected the catalog to be left unchanged")
+	}
+}
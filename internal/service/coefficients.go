@@ -0,0 +1,106 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// maxTableMonths is the longest term tabulated for programs without a term limit
+const maxTableMonths = 360
+
+// defaultCoefficients is the table of the built-in programs every new
+// calculator starts from, built once
+var defaultCoefficients = sync.OnceValue(func() *coefficientTable {
+	return buildCoefficientTable(DefaultPrograms, nil)
+})
+
+// annuityValue is a precomputed (1 + r)^n with its annuity coefficient
+type annuityValue struct {
+	power       decimal.Decimal
+	coefficient decimal.Decimal
+}
+
+// coefficientTable holds the annuity coefficients of every monthly rate the
+// programs can resolve to, indexed by the period rate and the number of payments.
+// The table is immutable once built and is replaced as a whole when programs change.
+type coefficientTable struct {
+	rows map[string][]annuityValue
+}
+
+// buildCoefficientTable tabulates each tier rate combined with every subset of
+// the program modifiers for terms up to the program maximum. A row depends only
+// on the rate, so rows of the previous table are reused and a rebuild after a
+// program change computes only new rates, while rates no longer offered are dropped.
+func buildCoefficientTable(programs []Program, previous *coefficientTable) *coefficientTable {
+	monthly := frequencies[model.FrequencyMonthly]
+	terms := make(map[string]int)
+	rates := make(map[string]decimal.Decimal)
+
+	for _, program := range programs {
+		maxMonths := program.Limits.MaxMonths
+		if maxMonths == 0 {
+			maxMonths = maxTableMonths
+		}
+
+		for _, rate := range program.rates() {
+			periodRate := monthly.periodRate(rate)
+			key := periodRate.String()
+			rates[key] = periodRate
+			terms[key] = max(terms[key], maxMonths)
+		}
+	}
+
+	table := &coefficientTable{rows: make(map[string][]annuityValue, len(rates))}
+	for key, periodRate := range rates {
+		if previous != nil {
+			if row, ok := previous.rows[key]; ok && len(row) > terms[key] {
+				table.rows[key] = row
+				continue
+			}
+		}
+
+		row, err := annuityRow(periodRate, terms[key])
+		if err != nil {
+			// Validated programs have positive rates only, an invalid rate
+			// is left to fail where it is priced
+			continue
+		}
+		table.rows[key] = row
+	}
+
+	return table
+}
+
+// annuityRow returns the annuity values for 0..periods payments, computed
+// with the same routine as uncached coefficients so results do not depend
+// on whether a term was tabulated
+func annuityRow(periodRate decimal.Decimal, periods int) ([]annuityValue, error) {
+	row := make([]annuityValue, periods+1)
+	for n := 1; n <= periods; n++ {
+		power, coefficient, err := annuity(periodRate, n, annuityPrecision)
+		if err != nil {
+			return nil, err
+		}
+		row[n] = annuityValue{power: power, coefficient: coefficient}
+	}
+
+	return row, nil
+}
+
+// coefficient returns the annuity coefficient from the table, computing it
+// for rates and terms that were not tabulated
+func (t *coefficientTable) coefficient(periodRate decimal.Decimal, periods int, trace *model.Trace) (decimal.Decimal, error) {
+	if t != nil && periods > 0 {
+		if row, ok := t.rows[periodRate.String()]; ok && periods < len(row) {
+			trace.Step("power", "(1 + r)^n, precomputed", row[periods].power)
+			trace.Step("annuity coefficient", "r * (1 + r)^n / ((1 + r)^n - 1), precomputed", row[periods].coefficient)
+
+			return row[periods].coefficient, nil
+		}
+	}
+
+	return annuityCoefficient(periodRate, periods, trace)
+}
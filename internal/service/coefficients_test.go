@@ -0,0 +1,148 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// TestCoefficientTable checks that every tabulated coefficient equals the computed one
+func TestCoefficientTable(t *testing.T) {
+	table := buildCoefficientTable(DefaultPrograms, nil)
+	monthly := frequencies[model.FrequencyMonthly]
+
+	for _, program := range DefaultPrograms {
+		for _, rate := range program.rates() {
+			periodRate := monthly.periodRate(rate)
+			row, ok := table.rows[periodRate.String()]
+			if !ok {
+				t.Fatalf("%s: rate %s is not tabulated", program.Code, rate)
+			}
+			if len(row) <= program.Limits.MaxMonths {
+				t.Fatalf("%s: rate %s is tabulated up to %d months, expected %d",
+					program.Code, rate, len(row)-1, program.Limits.MaxMonths)
+			}
+
+			for months := 1; months < len(row); months++ {
+				got, _ := table.coefficient(periodRate, months, nil)
+				if want, _ := annuityCoefficient(periodRate, months, nil); !got.Equal(want) {
+					t.Fatalf("%s at %s%% for %d months: coefficient %s differs from computed", program.Code, rate, months, got)
+				}
+			}
+		}
+	}
+}
+
+// TestCoefficientTable_Rebuild checks that the table follows limit changes
+// and that terms beyond it are still calculated
+func TestCoefficientTable_Rebuild(t *testing.T) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	calculator := NewMortCalculator()
+
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         420,
+		Program:        model.ProgramRequest{Code: "salary"},
+	}
+
+	limits := SalaryProgram.Limits
+	limits.MaxMonths = 420
+	if err := calculator.SetLimits(SalaryProgram.Code, limits); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, trace, err := calculator.Explain(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !hasStep(trace, "annuity coefficient", "precomputed") {
+		t.Errorf("Expected the coefficient for 420 months to be precomputed after the limit change")
+	}
+
+	// Semi-annual compounding resolves to a rate outside the table
+	request.Months = 240
+	request.Compounding = model.CompoundingSemiAnnual
+	_, trace, err = calculator.Explain(request, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if hasStep(trace, "annuity coefficient", "precomputed") {
+		t.Errorf("Expected the coefficient for semi-annual compounding to be calculated")
+	}
+}
+
+// TestCoefficientTable_Previous checks that a rebuild reuses the rows of the
+// previous table and keeps only the rates still offered
+func TestCoefficientTable_Previous(t *testing.T) {
+	previous := buildCoefficientTable([]Program{BaseProgram, FarEastProgram}, nil)
+
+	changed := FarEastProgram
+	changed.Tiers = []model.RateTier{{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(2.5)}}
+	table := buildCoefficientTable([]Program{BaseProgram, changed}, previous)
+
+	monthly := frequencies[model.FrequencyMonthly]
+	for _, rate := range BaseProgram.rates() {
+		key := monthly.periodRate(rate).String()
+		if &table.rows[key][1] != &previous.rows[key][1] {
+			t.Errorf("Expected the row of rate %s to be reused", rate)
+		}
+	}
+	for _, rate := range FarEastProgram.rates() {
+		if _, ok := table.rows[monthly.periodRate(rate).String()]; ok {
+			t.Errorf("Expected the row of rate %s, no longer offered, to be dropped", rate)
+		}
+	}
+	if len(table.rows) != len(BaseProgram.rates())+len(changed.rates()) {
+		t.Errorf("Expected %d rows, got %d", len(BaseProgram.rates())+len(changed.rates()), len(table.rows))
+	}
+}
+
+func hasStep(trace *model.Trace, name, formulaPart string) bool {
+	for _, step := range trace.Steps {
+		if step.Name == name && strings.HasSuffix(step.Formula, formulaPart) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var benchmarkAggregates model.Aggregates
+
+func benchmarkCalculateParallel(b *testing.B, calculator *MortCalculator) {
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	request := model.ExecuteRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        model.ProgramRequest{Code: "salary"},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var agg model.Aggregates
+		for pb.Next() {
+			agg, _ = calculator.Calculate(request, baseTime)
+		}
+		benchmarkAggregates = agg
+	})
+}
+
+func BenchmarkCalculate_Precomputed(b *testing.B) {
+	benchmarkCalculateParallel(b, NewMortCalculator())
+}
+
+func BenchmarkCalculate_Computed(b *testing.B) {
+	calculator := NewMortCalculator()
+	withoutTable := *calculator.current()
+	withoutTable.coefficients = nil
+	calculator.catalog.Store(&withoutTable)
+
+	benchmarkCalculateParallel(b, calculator)
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// ratePrecision is the number of decimal places of period rates
+// derived with fractional exponents
+const ratePrecision = 16
+
+// compoundingPerYear is the number of compounding periods per year by convention
+var compoundingPerYear = map[string]int{
+	model.CompoundingMonthly:    12,
+	model.CompoundingSemiAnnual: 2,
+	model.CompoundingAnnual:     1,
+}
+
+// resolvePeriodRate converts the nominal annual rate in percent to the rate of a single
+// payment period. By default interest compounds once per payment period,
+// otherwise the rate compounded m times a year is converted to the equivalent
+// rate per payment: (1 + j/m)^(m/p) - 1.
+func resolvePeriodRate(annualRate decimal.Decimal, frequency paymentFrequency, compounding string) (decimal.Decimal, error) {
+	if compounding == "" {
+		return frequency.periodRate(annualRate), nil
+	}
+
+	perYear, ok := compoundingPerYear[compounding]
+	if !ok {
+		return DecimalZero, model.ErrCompoundingInvalid
+	}
+
+	if perYear == frequency.perYear {
+		return frequency.periodRate(annualRate), nil
+	}
+
+	m := decimal.NewFromInt(int64(perYear))
+	exponent := m.Div(decimal.NewFromInt(int64(frequency.perYear)))
+
+	power, err := DecimalOne.Add(annualRate.Div(DecimalHundred).Div(m)).PowWithPrecision(exponent, ratePrecision)
+	if err != nil {
+		return DecimalZero, err
+	}
+
+	return power.Sub(DecimalOne).Round(ratePrecision), nil
+}
+
+// periodRateFormula describes how the period rate is derived for the trace
+func periodRateFormula(frequency paymentFrequency, compounding string) string {
+	perYear, ok := compoundingPerYear[compounding]
+	if !ok || perYear == frequency.perYear {
+		return fmt.Sprintf("rate / 100 / %d", frequency.perYear)
+	}
+
+	return fmt.Sprintf("(1 + rate / 100 / %d)^(%d / %d) - 1", perYear, perYear, frequency.perYear)
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// constructionPhase describes the interest-only period of an off-plan loan
+type constructionPhase struct {
+	// months from the contract date to the final disbursement
+	months int
+	// interest paid on the drawn tranches during the construction
+	interest decimal.Decimal
+}
+
+// calculateConstruction computes the construction phase for the disbursement schedule.
+// Each tranche accrues interest from its own disbursement month until the final draw,
+// after which the whole loan sum is amortized over the remaining term.
+// An empty schedule means the loan is disbursed in full at signing.
+func calculateConstruction(tranches []model.Disbursement, loanSum, monthlyRate decimal.Decimal, months int) (constructionPhase, error) {
+	if len(tranches) == 0 {
+		return constructionPhase{interest: DecimalZero}, nil
+	}
+
+	sorted := make([]model.Disbursement, len(tranches))
+	copy(sorted, tranches)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Month < sorted[j].Month
+	})
+
+	total := DecimalZero
+	for _, t := range sorted {
+		if t.Month < 0 || !t.Amount.IsPositive() {
+			return constructionPhase{}, model.ErrDisbursementInvalid
+		}
+		total = total.Add(t.Amount)
+	}
+
+	if !total.Equal(loanSum) {
+		return constructionPhase{}, model.ErrDisbursementSum
+	}
+
+	finalMonth := sorted[len(sorted)-1].Month
+	if finalMonth >= months {
+		return constructionPhase{}, model.ErrDisbursementInvalid
+	}
+
+	interest := DecimalZero
+	for _, t := range sorted {
+		drawnMonths := decimal.NewFromInt(int64(finalMonth - t.Month))
+		interest = interest.Add(t.Amount.Mul(monthlyRate).Mul(drawnMonths))
+	}
+
+	return constructionPhase{
+		months:   finalMonth,
+		interest: interest.Round(0),
+	}, nil
+}
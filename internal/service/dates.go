@@ -0,0 +1,100 @@
+package service
+
+import (
+	"time"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// paymentCalendar generates the dates of regular payments
+type paymentCalendar struct {
+	frequency paymentFrequency
+	// date of the first regular payment
+	first time.Time
+	// day of month all following payments are anchored to
+	day int
+}
+
+// newPaymentCalendar builds the calendar from the request dates.
+// baseTime is used as the contract date when the request does not specify one.
+func newPaymentCalendar(req model.ExecuteRequest, baseTime time.Time) (paymentCalendar, error) {
+	if req.PaymentDay < 0 || req.PaymentDay > 31 {
+		return paymentCalendar{}, model.ErrPaymentDayInvalid
+	}
+
+	frequency, err := parseFrequency(req.Frequency)
+	if err != nil {
+		return paymentCalendar{}, err
+	}
+
+	contract := model.NewDate(baseTime).Time
+	if req.ContractDate != nil {
+		contract = req.ContractDate.Time
+	}
+
+	// Annuity-due payments start at signing
+	if req.AnnuityDue {
+		if req.FirstPaymentDate != nil {
+			return paymentCalendar{}, model.ErrAnnuityDueConflict
+		}
+
+		day := req.PaymentDay
+		if day == 0 {
+			day = contract.Day()
+		}
+
+		return paymentCalendar{frequency: frequency, first: contract, day: day}, nil
+	}
+
+	if req.FirstPaymentDate != nil {
+		first := req.FirstPaymentDate.Time
+		if !first.After(contract) {
+			return paymentCalendar{}, model.ErrFirstPaymentTooEarly
+		}
+
+		day := req.PaymentDay
+		if day == 0 {
+			day = first.Day()
+		}
+
+		return paymentCalendar{frequency: frequency, first: first, day: day}, nil
+	}
+
+	day := req.PaymentDay
+	if day == 0 {
+		day = contract.Day()
+	}
+
+	calendar := paymentCalendar{frequency: frequency, first: contract, day: day}
+	calendar.first = calendar.advance(contract, 1)
+
+	return calendar, nil
+}
+
+// paymentDate returns the date of the n-th regular payment, starting from 1
+func (c paymentCalendar) paymentDate(n int) time.Time {
+	if n <= 1 {
+		return c.first
+	}
+
+	return c.advance(c.first, n-1)
+}
+
+// advance moves the date by a number of payment periods
+func (c paymentCalendar) advance(t time.Time, periods int) time.Time {
+	if c.frequency.months == 0 {
+		return t.AddDate(0, 0, periods*c.frequency.days)
+	}
+
+	return addMonthsClamped(t, periods*c.frequency.months, c.day)
+}
+
+// addMonthsClamped adds months to t and sets the day of month to day,
+// clamped to the last day of the resulting month, so that Jan 31 plus
+// one month is Feb 28 (or 29) instead of rolling over into March
+func addMonthsClamped(t time.Time, months, day int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+
+	return firstOfMonth.AddDate(0, 0, min(day, lastDay)-1)
+}
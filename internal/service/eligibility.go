@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/rules"
+)
+
+// EligibilityChecker checks which programs an applicant qualifies for
+type EligibilityChecker interface {
+	CheckEligibility(applicant model.Applicant, features model.Features) []model.EligibilityResult
+}
+
+// EligibilityRule is a single program condition checked against the applicant
+type EligibilityRule struct {
+	// Name identifies the rule in the program catalog
+	Name      string
+	Condition string
+	// Expression is the condition in the rule language, see package rules
+	Expression *rules.Expression
+}
+
+// ApplicantSchema lists the applicant attributes rule expressions can refer to
+var ApplicantSchema = rules.Schema{
+	"age":                 rules.Number,
+	"children_ages":       rules.NumberList,
+	"employer_accredited": rules.Bool,
+	"region":              rules.String,
+	"property_type":       rules.String,
+	"employment":          rules.String,
+	"experience_months":   rules.Number,
+}
+
+// NewEligibilityRule compiles the expression of a rule
+func NewEligibilityRule(name, condition, expression string) (EligibilityRule, error) {
+	if name == "" {
+		return EligibilityRule{}, errors.New("rule name is required")
+	}
+
+	compiled, err := rules.Compile(expression, ApplicantSchema)
+	if err != nil {
+		return EligibilityRule{}, fmt.Errorf("rule %s: %w", name, err)
+	}
+
+	if condition == "" {
+		condition = expression
+	}
+
+	return EligibilityRule{Name: name, Condition: condition, Expression: compiled}, nil
+}
+
+func mustRule(name, condition, expression string) EligibilityRule {
+	rule, err := NewEligibilityRule(name, condition, expression)
+	if err != nil {
+		panic(err)
+	}
+
+	return rule
+}
+
+// applicantAttributes exposes the applicant to rule expressions
+func applicantAttributes(a model.Applicant) rules.Attributes {
+	// Negative ages are not children, so that count(children_ages < 6) does not count them
+	childrenAges := make([]int, 0, len(a.ChildrenAges))
+	for _, age := range a.ChildrenAges {
+		if age >= 0 {
+			childrenAges = append(childrenAges, age)
+		}
+	}
+
+	return rules.Attributes{
+		"age":                 a.Age,
+		"children_ages":       childrenAges,
+		"employer_accredited": a.EmployerAccredited,
+		"region":              a.Region,
+		"property_type":       a.PropertyType,
+		"employment":          a.Employment,
+		"experience_months":   a.ExperienceMonths,
+	}
+}
+
+// FarEastRegions are the Far East and Arctic zone regions of the far_east program
+var FarEastRegions = []string{
+	"amur", "buryatia", "chukotka", "jewish", "kamchatka", "khabarovsk", "magadan",
+	"murmansk", "nenets", "primorsky", "sakha", "sakhalin", "yamal", "zabaykalsky",
+}
+
+var (
+	ruleChildren = mustRule("children",
+		"at least one child under 6 or two children under 18",
+		"count(children_ages < 6) >= 1 or count(children_ages < 18) >= 2")
+	ruleNewBuild = mustRule("new_build",
+		"property is a new build",
+		`property_type == "new_build"`)
+	ruleAccreditedEmployer = mustRule("accredited_employer",
+		"employer is an accredited IT company",
+		"employer_accredited")
+	ruleITAge = mustRule("it_age",
+		"applicant is 18 to 50 years old",
+		"age >= 18 and age <= 50")
+	ruleFarEastRegion = mustRule("far_east_region",
+		"property is in the Far East or the Arctic zone",
+		"region in "+stringList(FarEastRegions))
+	ruleFarEastAge = mustRule("far_east_age",
+		"applicant is not older than 35",
+		"age > 0 and age <= 35")
+	ruleFarEastProperty = mustRule("far_east_property",
+		"property is a new build or a private house",
+		`property_type in ["new_build", "house"]`)
+
+	// EligibilityRules are the built-in rules a program catalog can refer to, by name
+	EligibilityRules = rulesByName(
+		ruleChildren, ruleNewBuild, ruleAccreditedEmployer, ruleITAge,
+		ruleFarEastRegion, ruleFarEastAge, ruleFarEastProperty,
+	)
+)
+
+func rulesByName(rules ...EligibilityRule) map[string]EligibilityRule {
+	byName := make(map[string]EligibilityRule, len(rules))
+	for _, rule := range rules {
+		byName[rule.Name] = rule
+	}
+
+	return byName
+}
+
+// stringList formats the values as a list literal of the rule language
+func stringList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// checkEligibility evaluates all program rules against the applicant
+func (p Program) checkEligibility(applicant model.Applicant) model.EligibilityResult {
+	result := model.EligibilityResult{
+		Program:  p.Code,
+		Eligible: true,
+		Checks:   make([]model.EligibilityCheck, 0, len(p.Rules)),
+	}
+
+	attributes := applicantAttributes(applicant)
+	for _, rule := range p.Rules {
+		outcome := rule.Expression.Evaluate(attributes)
+		result.Checks = append(result.Checks, model.EligibilityCheck{
+			Rule:      rule.Name,
+			Condition: rule.Condition,
+			Passed:    outcome.Passed,
+			Reason:    outcome.Reason(),
+		})
+		result.Eligible = result.Eligible && outcome.Passed
+	}
+
+	return result
+}
+
+// requireEligibility returns an error listing the failed conditions
+// when the program has rules the applicant does not meet
+func (p Program) requireEligibility(applicant *model.Applicant, trace *model.Trace) error {
+	if len(p.Rules) == 0 {
+		return nil
+	}
+
+	if applicant == nil {
+		return model.ErrApplicantRequired
+	}
+
+	result := p.checkEligibility(*applicant)
+	for _, check := range result.Checks {
+		trace.Check("eligibility: "+check.Condition, conditionText(check.Passed), "met", check.Passed)
+	}
+
+	if result.Eligible {
+		return nil
+	}
+
+	failed := make([]string, 0, len(result.Checks))
+	for _, check := range result.Checks {
+		if !check.Passed {
+			failed = append(failed, check.Condition+" ("+check.Reason+")")
+		}
+	}
+
+	return &model.NotEligibleError{Program: p.Code, Failed: failed}
+}
+
+func conditionText(passed bool) string {
+	if passed {
+		return "met"
+	}
+
+	return "not met"
+}
+
+// CheckEligibility checks the applicant against every program offered to a request with the features
+func (c *MortCalculator) CheckEligibility(applicant model.Applicant, features model.Features) []model.EligibilityResult {
+	programs := c.current().active(features)
+	results := make([]model.EligibilityResult, 0, len(programs))
+	for _, program := range programs {
+		results = append(results, program.checkEligibility(applicant))
+	}
+
+	return results
+}
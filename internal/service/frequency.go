@@ -0,0 +1,131 @@
+package service
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// paymentFrequency describes how often regular payments are made.
+// Calendar-based frequencies step by months, the others by days.
+type paymentFrequency struct {
+	code    string
+	perYear int
+	months  int
+	days    int
+	// accelerated frequencies pay half of the monthly payment every period,
+	// 13 monthly payments a year, until the balance is repaid ahead of the term
+	accelerated bool
+}
+
+var frequencies = map[string]paymentFrequency{
+	model.FrequencyWeekly:    {code: model.FrequencyWeekly, perYear: 52, days: 7},
+	model.FrequencyBiweekly:  {code: model.FrequencyBiweekly, perYear: 26, days: 14, accelerated: true},
+	model.FrequencyMonthly:   {code: model.FrequencyMonthly, perYear: 12, months: 1},
+	model.FrequencyQuarterly: {code: model.FrequencyQuarterly, perYear: 4, months: 3},
+}
+
+// parseFrequency resolves the requested frequency, monthly by default
+func parseFrequency(code string) (paymentFrequency, error) {
+	if code == "" {
+		code = model.FrequencyMonthly
+	}
+
+	f, ok := frequencies[code]
+	if !ok {
+		return paymentFrequency{}, model.ErrFrequencyInvalid
+	}
+
+	return f, nil
+}
+
+func (f paymentFrequency) monthly() bool {
+	return f.code == model.FrequencyMonthly
+}
+
+// periods returns the number of payments made over a term in months.
+// Day-based frequencies are rounded to the nearest whole payment.
+func (f paymentFrequency) periods(months int) (int, error) {
+	if f.months > 0 {
+		if months%f.months != 0 {
+			return 0, model.ErrTermFrequency
+		}
+		return months / f.months, nil
+	}
+
+	return int(decimal.NewFromInt(int64(months * f.perYear)).Div(DecimalTwelve).Round(0).IntPart()), nil
+}
+
+// periodRate converts the annual rate in percent to the rate of a single period
+func (f paymentFrequency) periodRate(annualRate decimal.Decimal) decimal.Decimal {
+	return annualRate.Div(DecimalHundred).Div(decimal.NewFromInt(int64(f.perYear)))
+}
+
+// acceleratedPayment returns half of the monthly annuity payment for the term
+// in months, which an accelerated frequency pays every period
+func acceleratedPayment(loanSum, annualRate decimal.Decimal, months int, compounding string,
+	due, bankersRounding bool, coefficients *coefficientTable, trace *model.Trace,
+) (decimal.Decimal, error) {
+	monthlyRate, err := resolvePeriodRate(annualRate, frequencies[model.FrequencyMonthly], compounding)
+	if err != nil {
+		return DecimalZero, err
+	}
+
+	coefficient, err := coefficients.coefficient(monthlyRate, months, trace)
+	if err != nil {
+		return DecimalZero, err
+	}
+	monthlyPayment := annuityPayment(loanSum, monthlyRate, coefficient, due, bankersRounding, trace)
+
+	payment := monthlyPayment.Div(decimal.NewFromInt(2))
+	trace.Step("accelerated payment", "monthly payment / 2", payment)
+
+	return payment, nil
+}
+
+// repayAccelerated pays the payment every period until the balance is repaid,
+// the last payment covers what is left. Interest accrues on the balance before
+// each payment, or after it for annuity-due. It returns the number of payments,
+// at most maxPeriods, and their total.
+func repayAccelerated(loanSum, periodRate, payment decimal.Decimal, due bool, maxPeriods int) (int, decimal.Decimal) {
+	balance, total := loanSum, DecimalZero
+	periods := 0
+	for balance.IsPositive() && periods < maxPeriods {
+		if !due {
+			balance = balance.Add(balance.Mul(periodRate).Round(2))
+		}
+
+		paid := decimal.Min(payment, balance)
+		balance = balance.Sub(paid)
+		total = total.Add(paid)
+		periods++
+
+		if due {
+			balance = balance.Add(balance.Mul(periodRate).Round(2))
+		}
+	}
+
+	return periods, total
+}
+
+// termMonths returns the number of months the payments take, rounded up
+func (f paymentFrequency) termMonths(periods int) int {
+	if f.months > 0 {
+		return periods * f.months
+	}
+
+	return int(decimal.NewFromInt(int64(periods * 12)).Div(decimal.NewFromInt(int64(f.perYear))).Ceil().IntPart())
+}
+
+// describe reports a non-monthly schedule in the aggregates,
+// monthly schedules keep the original response shape
+func (f paymentFrequency) describe(agg *model.Aggregates, payment decimal.Decimal, periods int) {
+	if f.monthly() {
+		return
+	}
+
+	agg.Frequency = f.code
+	agg.Payments = periods
+	agg.PeriodPayment = &payment
+	agg.MonthlyPayment = payment.Mul(decimal.NewFromInt(int64(f.perYear))).Div(DecimalTwelve).Round(0)
+}
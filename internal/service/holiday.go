@@ -0,0 +1,63 @@
+package service
+
+import (
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// MaxHolidayMonths is the longest payment holiday a borrower can take
+const MaxHolidayMonths = 6
+
+// holidayEffect describes how a payment holiday changes the loan
+type holidayEffect struct {
+	// months the term is extended by
+	months int
+	// amount paid after the original term
+	deferred decimal.Decimal
+	// interest exceeding the interest part of the frozen payments
+	cost decimal.Decimal
+}
+
+// calculateHoliday applies a payment holiday to the annuity schedule.
+// During the holiday no payments are made and interest accrues on the frozen
+// principal at the contract rate without capitalization. After the holiday the
+// original schedule resumes, while the skipped principal and the accrued interest
+// are paid after the end of the original term.
+func calculateHoliday(holiday *model.PaymentHoliday, loanSum, monthlyRate, payment decimal.Decimal, months int) (holidayEffect, error) {
+	if holiday == nil {
+		return holidayEffect{deferred: DecimalZero, cost: DecimalZero}, nil
+	}
+
+	if holiday.Months > MaxHolidayMonths {
+		return holidayEffect{}, model.ErrHolidayTooLong
+	}
+
+	if holiday.Months <= 0 || holiday.StartMonth <= 0 || holiday.StartMonth+holiday.Months-1 > months {
+		return holidayEffect{}, model.ErrHolidayInvalid
+	}
+
+	balance := loanSum
+	for i := 1; i < holiday.StartMonth; i++ {
+		balance = balance.Sub(payment.Sub(balance.Mul(monthlyRate)))
+	}
+
+	holidayMonths := decimal.NewFromInt(int64(holiday.Months))
+	accrued := balance.Mul(monthlyRate).Mul(holidayMonths)
+
+	// Interest the frozen payments would have covered under the original schedule
+	scheduled := DecimalZero
+	for i := 0; i < holiday.Months; i++ {
+		interest := balance.Mul(monthlyRate)
+		scheduled = scheduled.Add(interest)
+		balance = balance.Sub(payment.Sub(interest))
+	}
+
+	cost := accrued.Sub(scheduled).Round(0)
+
+	return holidayEffect{
+		months:   holiday.Months,
+		deferred: payment.Mul(holidayMonths).Add(cost),
+		cost:     cost,
+	}, nil
+}
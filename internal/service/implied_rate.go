@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+var (
+	// Precision of the implied period rate and the number of bisection steps
+	// needed to reach it from the initial bracket
+	impliedRateTolerance  = decimal.New(1, -15)
+	impliedRateIterations = 100
+
+	// Decimal places of the implied annual rate in percent
+	impliedRatePlaces int32 = 4
+)
+
+// RateSolver finds the rate implied by a quoted payment and compares it with our programs
+type RateSolver interface {
+	ImpliedRate(req model.ImpliedRateRequest, baseTime time.Time) (model.ImpliedRateResult, error)
+}
+
+// ImpliedRate solves the annual rate at which the quoted monthly payment repays
+// the loan and lists the programs with a lower payment for the same loan
+func (c *MortCalculator) ImpliedRate(req model.ImpliedRateRequest, baseTime time.Time) (model.ImpliedRateResult, error) {
+	if !req.ObjectCost.IsPositive() || req.Months <= 0 || !req.MonthlyPayment.IsPositive() ||
+		req.InitialPayment.GreaterThanOrEqual(req.ObjectCost) {
+		return model.ImpliedRateResult{}, errors.New("invalid params")
+	}
+
+	loanSum := req.ObjectCost.Sub(req.InitialPayment)
+	monthlyRate, err := solvePeriodRate(loanSum, req.MonthlyPayment, req.Months)
+	if err != nil {
+		return model.ImpliedRateResult{}, err
+	}
+
+	result := model.ImpliedRateResult{
+		ImpliedRate: monthlyRate.Mul(DecimalTwelve).Mul(DecimalHundred).Round(impliedRatePlaces),
+		Offers:      []model.ProgramOffer{},
+	}
+
+	cat := c.current()
+	result.CatalogVersion = cat.version
+
+	for _, program := range cat.active(req.Features) {
+		agg, err := c.calculateIn(cat, model.ExecuteRequest{
+			ObjectCost:     req.ObjectCost,
+			InitialPayment: req.InitialPayment,
+			Months:         req.Months,
+			Program:        model.ProgramRequest{Code: program.Code},
+			Applicant:      req.Applicant,
+			Features:       req.Features,
+		}, baseTime, nil)
+		// Programs the loan does not qualify for are not offered
+		if err != nil || agg.MonthlyPayment.GreaterThanOrEqual(req.MonthlyPayment) {
+			continue
+		}
+
+		result.Offers = append(result.Offers, model.ProgramOffer{
+			Lender:         program.Lender,
+			Program:        program.Code,
+			Rate:           agg.Rate,
+			MonthlyPayment: agg.MonthlyPayment,
+			MonthlySaving:  req.MonthlyPayment.Sub(agg.MonthlyPayment),
+		})
+	}
+
+	sort.SliceStable(result.Offers, func(i, j int) bool {
+		return result.Offers[i].MonthlySaving.GreaterThan(result.Offers[j].MonthlySaving)
+	})
+
+	return result, nil
+}
+
+// solvePeriodRate finds the period rate r at which the annuity payment on the loan
+// equals the quoted one. The payment grows with the rate, so the root is
+// bracketed and then found by bisection.
+func solvePeriodRate(loanSum, payment decimal.Decimal, periods int) (decimal.Decimal, error) {
+	n := decimal.NewFromInt(int64(periods))
+	zeroRatePayment := loanSum.Div(n)
+
+	switch {
+	case payment.LessThan(zeroRatePayment):
+		return DecimalZero, model.ErrQuotedPaymentLow
+	case payment.Equal(zeroRatePayment):
+		return DecimalZero, nil
+	}
+
+	// The interest alone must be below the payment, so r < payment / loanSum
+	low, high := DecimalZero, payment.Div(loanSum)
+
+	for i := 0; i < impliedRateIterations && high.Sub(low).GreaterThan(impliedRateTolerance); i++ {
+		// The midpoint is always above zero, where the coefficient is defined
+		mid := low.Add(high).Div(decimal.NewFromInt(2))
+		coefficient, err := annuityCoefficient(mid, periods, nil)
+		if err != nil {
+			return DecimalZero, err
+		}
+		if loanSum.Mul(coefficient).LessThan(payment) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return low.Add(high).Div(decimal.NewFromInt(2)), nil
+}
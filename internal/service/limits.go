@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// Limits constrains the loan parameters of a program, zero values mean no limit
+type Limits struct {
+	MinLoan   decimal.Decimal
+	MaxLoan   decimal.Decimal
+	MinMonths int
+	MaxMonths int
+	// RegionMaxLoan overrides MaxLoan for the listed regions
+	RegionMaxLoan map[string]decimal.Decimal
+}
+
+// maxLoan returns the loan cap in the region
+func (l Limits) maxLoan(region string) (decimal.Decimal, bool) {
+	if capped, ok := l.RegionMaxLoan[region]; ok {
+		return capped, true
+	}
+
+	return l.MaxLoan, false
+}
+
+// check validates the loan sum and the term against the limits
+func (l Limits) check(program string, loanSum decimal.Decimal, months int, region string, trace *model.Trace) error {
+	maxLoan, regional := l.maxLoan(region)
+	loanOK := loanSum.GreaterThanOrEqual(l.MinLoan) && (!maxLoan.IsPositive() || loanSum.LessThanOrEqual(maxLoan))
+	trace.Check("loan sum", loanSum, rangeText(l.MinLoan, maxLoan), loanOK)
+	if !loanOK {
+		err := &model.LimitError{
+			Program: program,
+			Limit:   "loan sum",
+			Unit:    "rub",
+			Value:   loanSum,
+			Min:     l.MinLoan,
+			Max:     maxLoan,
+		}
+		if regional {
+			err.Region = region
+		}
+
+		return err
+	}
+
+	minMonths, maxMonths := decimal.NewFromInt(int64(l.MinMonths)), decimal.NewFromInt(int64(l.MaxMonths))
+	termOK := months >= l.MinMonths && (l.MaxMonths <= 0 || months <= l.MaxMonths)
+	trace.Check("program term, months", months, rangeText(minMonths, maxMonths), termOK)
+	if !termOK {
+		return &model.LimitError{
+			Program: program,
+			Limit:   "term",
+			Unit:    "months",
+			Value:   decimal.NewFromInt(int64(months)),
+			Min:     minMonths,
+			Max:     maxMonths,
+		}
+	}
+
+	return nil
+}
+
+// rangeText formats an allowed range, a zero maximum means no upper bound
+func rangeText(lower, upper decimal.Decimal) string {
+	if !upper.IsPositive() {
+		return fmt.Sprintf("%s..", lower)
+	}
+
+	return fmt.Sprintf("%s..%s", lower, upper)
+}
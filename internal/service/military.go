@@ -0,0 +1,115 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// MilitaryAgeLimit is the age at which the state stops paying contributions
+const MilitaryAgeLimit = 45
+
+// DefaultMilitaryContributions are the annual state savings-accumulation
+// contributions per serviceman by calendar year. Years after the last known one
+// use its amount.
+var DefaultMilitaryContributions = map[int]decimal.Decimal{
+	2023: decimal.NewFromInt(330558),
+	2024: decimal.NewFromInt(350205),
+	2025: decimal.NewFromInt(379283),
+}
+
+// militaryContributions resolves the annual contribution by year
+type militaryContributions map[int]decimal.Decimal
+
+// years returns the years with a known contribution, sorted
+func (mc militaryContributions) years() []int {
+	years := make([]int, 0, len(mc))
+	for y := range mc {
+		years = append(years, y)
+	}
+	sort.Ints(years)
+
+	return years
+}
+
+// monthly returns the monthly state contribution in the given year,
+// years are the sorted years of mc
+func (mc militaryContributions) monthly(years []int, year int) decimal.Decimal {
+	annual := DecimalZero
+	for _, y := range years {
+		if y > year {
+			break
+		}
+		annual = mc[y]
+	}
+
+	// Years before the first known one use the earliest amount
+	if annual.IsZero() && len(years) > 0 {
+		annual = mc[years[0]]
+	}
+
+	return annual.Div(DecimalTwelve).Round(2)
+}
+
+// calculate simulates the loan serviced by the state contributions.
+// Every month the state pays its whole contribution: when it exceeds the regular
+// payment the excess repays the principal early, when it falls short the
+// serviceman covers the difference. After the age limit the serviceman pays the
+// regular payment alone.
+func (mc militaryContributions) calculate(birthDate time.Time, calendar paymentCalendar,
+	loanSum, monthlyRate, payment decimal.Decimal, months int,
+) (*model.MilitarySummary, error) {
+	contributionsEnd := birthDate.AddDate(MilitaryAgeLimit, 0, 0)
+	if !contributionsEnd.After(calendar.paymentDate(1)) {
+		return nil, model.ErrServicemanTooOld
+	}
+
+	summary := &model.MilitarySummary{
+		StateTotal:           DecimalZero,
+		OwnTotal:             DecimalZero,
+		ContributionsEndDate: contributionsEnd.Format(DateFormat),
+	}
+
+	// The years are sorted once for all the payments
+	years := mc.years()
+
+	balance := loanSum
+	for n := 1; balance.IsPositive(); n++ {
+		date := calendar.paymentDate(n)
+		due := balance.Add(balance.Mul(monthlyRate)).Round(2)
+
+		state := DecimalZero
+		if date.Before(contributionsEnd) {
+			state = decimal.Min(mc.monthly(years, date.Year()), due)
+		}
+		regular := decimal.Min(payment, due)
+		if n >= months {
+			regular = due
+		}
+		own := decimal.Max(regular.Sub(state), DecimalZero)
+
+		summary.StateTotal = summary.StateTotal.Add(state)
+		summary.OwnTotal = summary.OwnTotal.Add(own)
+		summary.PayoffDate = date.Format(DateFormat)
+		balance = due.Sub(state).Sub(own)
+
+		if len(summary.Years) == 0 || summary.Years[len(summary.Years)-1].Year != date.Year() {
+			summary.Years = append(summary.Years, model.MilitaryYear{
+				Year:         date.Year(),
+				StatePayment: DecimalZero,
+				OwnPayment:   DecimalZero,
+			})
+		}
+		year := &summary.Years[len(summary.Years)-1]
+		year.StatePayment = year.StatePayment.Add(state)
+		year.OwnPayment = year.OwnPayment.Add(own)
+	}
+
+	summary.StateTotal = summary.StateTotal.Round(0)
+	summary.OwnTotal = summary.OwnTotal.Round(0)
+
+	return summary, nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// Decimal places of the full cost of credit rate in percent
+const fullCostRatePlaces int32 = 3
+
+// OfferAggregator compares a loan across the programs of all lenders
+type OfferAggregator interface {
+	Offers(req model.OffersRequest, baseTime time.Time) (model.OffersResult, error)
+}
+
+// offerOrders compare two offers by each sort order, ties are broken by
+// the monthly payment and then by the program code
+var offerOrders = map[string]func(a, b model.LenderOffer) int{
+	model.SortByMonthlyPayment: func(a, b model.LenderOffer) int { return a.MonthlyPayment.Cmp(b.MonthlyPayment) },
+	model.SortByOverpayment:    func(a, b model.LenderOffer) int { return a.Overpayment.Cmp(b.Overpayment) },
+	model.SortByFullCost:       func(a, b model.LenderOffer) int { return a.FullCost.Cmp(b.FullCost) },
+}
+
+// Offers prices the loan with every active program of the requested lenders and
+// ranks the offers. Programs the loan does not qualify for are listed with the reason.
+func (c *MortCalculator) Offers(req model.OffersRequest, baseTime time.Time) (model.OffersResult, error) {
+	if !req.ObjectCost.IsPositive() || req.Months <= 0 || req.InitialPayment.GreaterThanOrEqual(req.ObjectCost) {
+		return model.OffersResult{}, errors.New("invalid params")
+	}
+
+	sortBy := req.SortBy
+	if sortBy == "" {
+		sortBy = model.SortByMonthlyPayment
+	}
+	compare, ok := offerOrders[sortBy]
+	if !ok {
+		return model.OffersResult{}, fmt.Errorf("%w: %s", model.ErrSortInvalid, sortBy)
+	}
+
+	lenders := make(map[string]bool, len(req.Lenders))
+	for _, lender := range req.Lenders {
+		lenders[lender] = true
+	}
+
+	cat := c.current()
+	result := model.OffersResult{
+		CatalogVersion: cat.version,
+		SortBy:         sortBy,
+		Offers:         []model.LenderOffer{},
+	}
+
+	for _, program := range cat.active(req.Features) {
+		if len(lenders) > 0 && !lenders[program.Lender] {
+			continue
+		}
+
+		offer, err := c.offer(cat, program, req, baseTime)
+		if err != nil {
+			result.Rejected = append(result.Rejected, model.RejectedOffer{
+				Lender:  program.Lender,
+				Program: program.Code,
+				Reason:  err.Error(),
+			})
+			continue
+		}
+		result.Offers = append(result.Offers, offer)
+	}
+
+	sort.SliceStable(result.Offers, func(i, j int) bool {
+		a, b := result.Offers[i], result.Offers[j]
+		if order := compare(a, b); order != 0 {
+			return order < 0
+		}
+		if order := a.MonthlyPayment.Cmp(b.MonthlyPayment); order != 0 {
+			return order < 0
+		}
+
+		return a.Program < b.Program
+	})
+
+	return result, nil
+}
+
+// offer prices the loan with the program and adds its fee to the cost of credit
+func (c *MortCalculator) offer(cat *catalog, program Program, req model.OffersRequest, baseTime time.Time) (model.LenderOffer, error) {
+	agg, err := c.calculateIn(cat, model.ExecuteRequest{
+		ObjectCost:     req.ObjectCost,
+		InitialPayment: req.InitialPayment,
+		Months:         req.Months,
+		Program:        model.ProgramRequest{Code: program.Code},
+		Applicant:      req.Applicant,
+		Region:         req.Region,
+		Features:       req.Features,
+	}, baseTime, nil)
+	if err != nil {
+		return model.LenderOffer{}, err
+	}
+
+	fee := agg.LoanSum.Mul(program.IssueFee).Div(DecimalHundred).Round(0)
+	fullCostRate, err := fullCostOfCredit(agg.LoanSum.Sub(fee), agg.MonthlyPayment, req.Months)
+	if err != nil {
+		return model.LenderOffer{}, err
+	}
+
+	return model.LenderOffer{
+		Lender:         program.Lender,
+		Program:        program.Code,
+		ProgramName:    program.Name,
+		Rate:           agg.Rate,
+		MonthlyPayment: agg.MonthlyPayment,
+		Overpayment:    agg.Overpayment,
+		IssueFee:       fee,
+		FullCost:       agg.Overpayment.Add(fee),
+		FullCostRate:   fullCostRate,
+	}, nil
+}
+
+// fullCostOfCredit returns the annual rate in percent at which the monthly
+// payments repay the amount the borrower actually receives:
+// FCR = i * 12 * 100
+// where i is the monthly rate solving net = payment * (1 - (1 + i)^-n) / i
+func fullCostOfCredit(net, payment decimal.Decimal, months int) (decimal.Decimal, error) {
+	monthlyRate, err := solvePeriodRate(net, payment, months)
+	if err != nil {
+		return DecimalZero, err
+	}
+
+	return monthlyRate.Mul(DecimalTwelve).Mul(DecimalHundred).Round(fullCostRatePlaces), nil
+}
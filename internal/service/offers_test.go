@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// newLendersCalculator adds a program of another lender with a lower rate
+// bought down by an issue fee
+func newLendersCalculator(t *testing.T) *MortCalculator {
+	promo := SalaryProgram
+	promo.Code = "alfa_promo"
+	promo.Name = "Promo rate"
+	promo.Lender = "alfa"
+	promo.IssueFee = decimal.NewFromInt(3)
+	promo.Tiers = []model.RateTier{{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(7.9)}}
+
+	calculator := NewMortCalculator()
+	if err := calculator.SetPrograms(append(append([]Program(nil), DefaultPrograms...), promo)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	return calculator
+}
+
+func TestOffers(t *testing.T) {
+	calculator := newLendersCalculator(t)
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+	request := model.OffersRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+	}
+
+	tests := []struct {
+		name     string
+		sortBy   string
+		expected []string
+	}{
+		{name: "Default order", expected: []string{"alfa_promo", "salary", "military", "base"}},
+		{name: "By overpayment", sortBy: model.SortByOverpayment, expected: []string{"alfa_promo", "salary", "military", "base"}},
+		// The fee outweighs the lower rate
+		{name: "By full cost", sortBy: model.SortByFullCost, expected: []string{"salary", "alfa_promo", "military", "base"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request.SortBy = tt.sortBy
+			result, err := calculator.Offers(request, baseTime)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(result.Offers) != len(tt.expected) {
+				t.Fatalf("Expected %d offers, got %+v", len(tt.expected), result.Offers)
+			}
+			for i, code := range tt.expected {
+				if result.Offers[i].Program != code {
+					t.Errorf("Expected %s at position %d, got %s", code, i+1, result.Offers[i].Program)
+				}
+			}
+
+			// The state programs need the applicant
+			if len(result.Rejected) != 3 {
+				t.Errorf("Expected 3 rejected programs, got %+v", result.Rejected)
+			}
+		})
+	}
+}
+
+func TestOffers_FullCost(t *testing.T) {
+	calculator := newLendersCalculator(t)
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+
+	result, err := calculator.Offers(model.OffersRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Lenders:        []string{"alfa"},
+	}, baseTime)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Offers) != 1 {
+		t.Fatalf("Expected the offer of the selected lender only, got %+v", result.Offers)
+	}
+
+	offer := result.Offers[0]
+	if !offer.IssueFee.Equal(decimal.NewFromInt(120000)) {
+		t.Errorf("Expected an issue fee of 120000, got %s", offer.IssueFee)
+	}
+	if !offer.FullCost.Equal(offer.Overpayment.Add(offer.IssueFee)) {
+		t.Errorf("Expected the full cost to include the fee, got %s", offer.FullCost)
+	}
+	if offer.FullCostRate.LessThanOrEqual(offer.Rate) {
+		t.Errorf("Expected the full cost rate %s to exceed the rate %s", offer.FullCostRate, offer.Rate)
+	}
+}
+
+func TestOffers_Errors(t *testing.T) {
+	calculator := NewMortCalculator()
+	baseTime := time.Date(2024, 2, 18, 12, 0, 0, 0, time.UTC)
+
+	_, err := calculator.Offers(model.OffersRequest{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		SortBy:         "rate",
+	}, baseTime)
+	if !errors.Is(err, model.ErrSortInvalid) {
+		t.Errorf("Expected error %v, got %v", model.ErrSortInvalid, err)
+	}
+
+	_, err = calculator.Offers(model.OffersRequest{ObjectCost: decimal.NewFromInt(5000000)}, baseTime)
+	if err == nil {
+		t.Error("Expected an error for a loan without a term")
+	}
+}
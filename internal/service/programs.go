@@ -0,0 +1,338 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// Program describes a mortgage program and its pricing
+type Program struct {
+	Code string
+	Name string
+	// Lender is the bank offering the program, empty for our own programs
+	Lender string
+	// IssueFee is a one-time fee paid at signing, percent of the loan sum
+	IssueFee decimal.Decimal
+	// Feature is the feature flag the program is rolled out with,
+	// the program is offered to the requests with the flag only
+	Feature string
+	// Inactive programs stay in the catalog but are not offered
+	Inactive bool
+	// Tiers are sorted by the minimum initial payment in ascending order,
+	// the first tier defines the minimum initial payment of the program
+	Tiers []model.RateTier
+	// Rates are rate tables sorted by the effective date, each replaces
+	// the tiers from its date on. Tiers apply before the first of them.
+	Rates []model.RatePeriod
+	// Modifiers is the catalogue of surcharges and discounts the client can select
+	Modifiers []model.RateModifier
+	// Limits constrain the loan sum and the term
+	Limits Limits
+	// Rules are the eligibility conditions of the program, all must pass
+	Rules []EligibilityRule
+}
+
+var (
+	// Regions with raised caps of the state programs
+	capitalRegions = []string{"moscow", "moscow_oblast", "spb", "leningrad_oblast"}
+
+	// Rate modifiers shared between programs
+	ModifierNoLifeInsurance = model.RateModifier{
+		Code:        "no_life_insurance",
+		Description: "borrower declines life insurance",
+		Delta:       decimal.NewFromFloat(1.0),
+	}
+	ModifierSalaryClient = model.RateModifier{
+		Code:        "salary_client",
+		Description: "salary project client",
+		Delta:       decimal.NewFromFloat(-0.3),
+	}
+	ModifierElectronicRegistration = model.RateModifier{
+		Code:        "e_registration",
+		Description: "electronic registration of the deal",
+		Delta:       decimal.NewFromFloat(-0.1),
+	}
+
+	// RateModifiers is the catalogue of modifiers programs can offer, by code
+	RateModifiers = map[string]model.RateModifier{
+		ModifierNoLifeInsurance.Code:        ModifierNoLifeInsurance,
+		ModifierSalaryClient.Code:           ModifierSalaryClient,
+		ModifierElectronicRegistration.Code: ModifierElectronicRegistration,
+	}
+
+	// Loan-to-value rate tables for different credit programs
+	SalaryProgram = Program{
+		Code: "salary",
+		Name: "Corporate client",
+		Tiers: []model.RateTier{
+			{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(8.0)},
+			{MinInitialPayment: decimal.NewFromInt(30), Rate: decimal.NewFromFloat(7.5)},
+		},
+		Modifiers: []model.RateModifier{ModifierNoLifeInsurance, ModifierElectronicRegistration},
+	}
+	MilitaryProgram = Program{
+		Code: "military",
+		Name: "Military mortgage",
+		Tiers: []model.RateTier{
+			{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(9.0)},
+			{MinInitialPayment: decimal.NewFromInt(30), Rate: decimal.NewFromFloat(8.5)},
+		},
+		Modifiers: []model.RateModifier{ModifierNoLifeInsurance, ModifierSalaryClient, ModifierElectronicRegistration},
+	}
+	BaseProgram = Program{
+		Code: "base",
+		Name: "Base program",
+		Tiers: []model.RateTier{
+			{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(10.0)},
+			{MinInitialPayment: decimal.NewFromInt(30), Rate: decimal.NewFromFloat(9.5)},
+		},
+		Modifiers: []model.RateModifier{ModifierNoLifeInsurance, ModifierSalaryClient, ModifierElectronicRegistration},
+	}
+
+	// State-subsidized programs
+	FamilyProgram = Program{
+		Code: "family",
+		Name: "Family mortgage",
+		Tiers: []model.RateTier{
+			{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(6.0)},
+		},
+		Modifiers: []model.RateModifier{ModifierNoLifeInsurance},
+		Limits: Limits{
+			MinLoan:       decimal.NewFromInt(300000),
+			MaxLoan:       decimal.NewFromInt(6000000),
+			MinMonths:     12,
+			MaxMonths:     360,
+			RegionMaxLoan: regionCaps(capitalRegions, decimal.NewFromInt(12000000)),
+		},
+		Rules: []EligibilityRule{ruleChildren, ruleNewBuild},
+	}
+	ITProgram = Program{
+		Code: "it",
+		Name: "IT mortgage",
+		Tiers: []model.RateTier{
+			{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(6.0)},
+		},
+		Modifiers: []model.RateModifier{ModifierNoLifeInsurance},
+		Limits: Limits{
+			MinLoan:       decimal.NewFromInt(300000),
+			MaxLoan:       decimal.NewFromInt(9000000),
+			MinMonths:     12,
+			MaxMonths:     360,
+			RegionMaxLoan: regionCaps(capitalRegions, decimal.NewFromInt(18000000)),
+		},
+		Rules: []EligibilityRule{ruleAccreditedEmployer, ruleITAge, ruleNewBuild},
+	}
+	FarEastProgram = Program{
+		Code: "far_east",
+		Name: "Far East and Arctic mortgage",
+		Tiers: []model.RateTier{
+			{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromFloat(2.0)},
+		},
+		Modifiers: []model.RateModifier{ModifierNoLifeInsurance},
+		Limits: Limits{
+			MinLoan:   decimal.NewFromInt(300000),
+			MaxLoan:   decimal.NewFromInt(6000000),
+			MinMonths: 12,
+			MaxMonths: 240,
+		},
+		Rules: []EligibilityRule{ruleFarEastRegion, ruleFarEastAge, ruleFarEastProperty},
+	}
+
+	// DefaultPrograms lists every program offered by the calculator
+	DefaultPrograms = []Program{
+		SalaryProgram, MilitaryProgram, BaseProgram,
+		FamilyProgram, ITProgram, FarEastProgram,
+	}
+)
+
+// validate checks that the program can be priced: a code, valid rate tiers,
+// uniquely named rules and modifiers, a fee below 100%, rate periods sorted by
+// the effective date and positive rates with every combination of the modifiers
+func (p Program) validate() error {
+	if p.Code == "" {
+		return fmt.Errorf("%w: code is required", ErrInvalidProgram)
+	}
+
+	if err := validateTiers(p.Code, p.Tiers); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(p.Rules))
+	for _, rule := range p.Rules {
+		if names[rule.Name] {
+			return fmt.Errorf("%w: %s: duplicate eligibility rule %s", ErrInvalidProgram, p.Code, rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	// Modifiers are applied once each, as selectModifiers does
+	modifiers := make(map[string]bool, len(p.Modifiers))
+	for _, m := range p.Modifiers {
+		if modifiers[m.Code] {
+			return fmt.Errorf("%w: %s: duplicate modifier %s", ErrInvalidProgram, p.Code, m.Code)
+		}
+		modifiers[m.Code] = true
+	}
+
+	if p.IssueFee.IsNegative() || p.IssueFee.GreaterThanOrEqual(DecimalHundred) {
+		return fmt.Errorf("%w: %s: issue fee must be from 0 to 100%%, got %s", ErrInvalidProgram, p.Code, p.IssueFee)
+	}
+
+	for i, period := range p.Rates {
+		if period.EffectiveFrom.IsZero() {
+			return fmt.Errorf("%w: %s: rate period effective date is required", ErrInvalidProgram, p.Code)
+		}
+		if i > 0 && !period.EffectiveFrom.After(p.Rates[i-1].EffectiveFrom.Time) {
+			return fmt.Errorf("%w: %s: rate periods must be sorted by the effective date", ErrInvalidProgram, p.Code)
+		}
+		if err := validateTiers(p.Code+" from "+period.EffectiveFrom.Format(DateFormat), period.Tiers); err != nil {
+			return err
+		}
+	}
+
+	// Discounts must not bring any rate the program resolves to down to zero,
+	// where the annuity is undefined
+	for _, rate := range p.rates() {
+		if !rate.IsPositive() {
+			return fmt.Errorf("%w: %s: rate with modifiers must be positive, got %s", ErrInvalidProgram, p.Code, rate)
+		}
+	}
+
+	return nil
+}
+
+// validateTiers checks at least one tier with a positive rate and tiers sorted
+// by a growing initial payment below 100%
+func validateTiers(name string, tiers []model.RateTier) error {
+	if len(tiers) == 0 {
+		return fmt.Errorf("%w: %s: at least one rate tier is required", ErrInvalidProgram, name)
+	}
+
+	for i, tier := range tiers {
+		if !tier.Rate.IsPositive() {
+			return fmt.Errorf("%w: %s: rate must be positive, got %s", ErrInvalidProgram, name, tier.Rate)
+		}
+		if tier.MinInitialPayment.IsNegative() || tier.MinInitialPayment.GreaterThanOrEqual(DecimalHundred) {
+			return fmt.Errorf("%w: %s: minimum initial payment must be from 0 to 100%%, got %s",
+				ErrInvalidProgram, name, tier.MinInitialPayment)
+		}
+		if i > 0 && !tier.MinInitialPayment.GreaterThan(tiers[i-1].MinInitialPayment) {
+			return fmt.Errorf("%w: %s: tiers must be sorted by the minimum initial payment", ErrInvalidProgram, name)
+		}
+	}
+
+	return nil
+}
+
+// tiersOn returns the rate tiers valid on the date and the date they are
+// effective from, which is zero for the base tiers
+func (p Program) tiersOn(date time.Time) ([]model.RateTier, time.Time) {
+	day := model.NewDate(date).Time
+	for i := len(p.Rates) - 1; i >= 0; i-- {
+		from := p.Rates[i].EffectiveFrom.Time
+		if !time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, day.Location()).After(day) {
+			return p.Rates[i].Tiers, from
+		}
+	}
+
+	return p.Tiers, time.Time{}
+}
+
+// selectTier returns the tier with the highest threshold the initial payment share reaches.
+// initialPercent is the initial payment as a percentage of the object cost.
+func selectTier(tiers []model.RateTier, initialPercent decimal.Decimal) (model.RateTier, error) {
+	for i := len(tiers) - 1; i >= 0; i-- {
+		if initialPercent.GreaterThanOrEqual(tiers[i].MinInitialPayment) {
+			return tiers[i], nil
+		}
+	}
+
+	return model.RateTier{}, model.ErrInitialPaymentLow
+}
+
+// selectModifiers resolves the requested modifier codes against the program catalogue.
+// Repeated codes are applied once.
+func (p Program) selectModifiers(codes []string) ([]model.RateModifier, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	selected := make([]model.RateModifier, 0, len(codes))
+	seen := make(map[string]bool, len(codes))
+
+	for _, code := range codes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		modifier, ok := p.findModifier(code)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", model.ErrUnknownModifier, code)
+		}
+		selected = append(selected, modifier)
+	}
+
+	return selected, nil
+}
+
+func (p Program) findModifier(code string) (model.RateModifier, bool) {
+	for _, m := range p.Modifiers {
+		if m.Code == code {
+			return m, true
+		}
+	}
+
+	return model.RateModifier{}, false
+}
+
+// rates returns every rate the program can resolve to: each tier rate of every
+// rate period adjusted by each combination of the modifiers
+func (p Program) rates() []decimal.Decimal {
+	tiers := p.Tiers
+	for _, period := range p.Rates {
+		tiers = append(tiers[:len(tiers):len(tiers)], period.Tiers...)
+	}
+
+	var rates []decimal.Decimal
+	for _, tier := range tiers {
+		for mask := 0; mask < 1<<len(p.Modifiers); mask++ {
+			rate := tier.Rate
+			for i, m := range p.Modifiers {
+				if mask&(1<<i) != 0 {
+					rate = rate.Add(m.Delta)
+				}
+			}
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates
+}
+
+// checkLoan validates the loan against the program limits and eligibility rules
+func (p Program) checkLoan(req model.ExecuteRequest, loanSum decimal.Decimal, trace *model.Trace) error {
+	region := req.Region
+	if region == "" && req.Applicant != nil {
+		region = req.Applicant.Region
+	}
+
+	if err := p.Limits.check(p.Code, loanSum, req.Months, region, trace); err != nil {
+		return err
+	}
+
+	return p.requireEligibility(req.Applicant, trace)
+}
+
+func regionCaps(regions []string, maxLoan decimal.Decimal) map[string]decimal.Decimal {
+	caps := make(map[string]decimal.Decimal, len(regions))
+	for _, region := range regions {
+		caps[region] = maxLoan
+	}
+
+	return caps
+}
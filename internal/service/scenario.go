@@ -0,0 +1,239 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/scenario"
+)
+
+// maxScheduleRows guards against scenarios that never repay the loan
+const maxScheduleRows = 1200
+
+// ErrScenarioNotRepaid is returned when the payments never cover the interest
+var ErrScenarioNotRepaid = errors.New("scenario does not repay the loan")
+
+// ScenarioEvaluator replays loan timelines
+type ScenarioEvaluator interface {
+	Evaluate(s scenario.Scenario) (model.ScenarioResult, error)
+}
+
+// Evaluate replays the scenario: the loan is validated and priced by the
+// calculator, then the monthly schedule is built applying each event from the
+// first payment on or after its date. Errors caused by an event name its line.
+func (c *MortCalculator) Evaluate(s scenario.Scenario) (model.ScenarioResult, error) {
+	start := model.NewDate(s.Loan.StartDate)
+	req := model.ExecuteRequest{
+		ObjectCost:     s.Loan.ObjectCost,
+		InitialPayment: s.Loan.InitialPayment,
+		Months:         s.Loan.Months,
+		Program:        model.ProgramRequest{Code: s.Loan.Program},
+		Modifiers:      s.Loan.Modifiers,
+		ContractDate:   &start,
+		PaymentDay:     s.Loan.PaymentDay,
+	}
+
+	agg, err := c.Calculate(req, start.Time)
+	if err != nil {
+		return model.ScenarioResult{}, err
+	}
+
+	calendar, err := newPaymentCalendar(req, start.Time)
+	if err != nil {
+		return model.ScenarioResult{}, err
+	}
+
+	t := &timeline{
+		coefficients: c.current().coefficients,
+		frequency:    calendar.frequency,
+		rate:         agg.Rate,
+		periodRate:   calendar.frequency.periodRate(agg.Rate),
+		payment:      agg.MonthlyPayment,
+		balance:      agg.LoanSum,
+		deferred:     DecimalZero,
+		remaining:    req.Months,
+	}
+
+	result := model.ScenarioResult{
+		Name:           s.Name,
+		CatalogVersion: agg.CatalogVersion,
+		Program:        s.Loan.Program,
+		LoanSum:        agg.LoanSum,
+		MonthlyPayment: agg.MonthlyPayment,
+		TotalPaid:      DecimalZero,
+	}
+
+	next := 0
+	for n := 1; t.balance.IsPositive() || t.deferred.IsPositive(); n++ {
+		if n > maxScheduleRows {
+			return model.ScenarioResult{}, ErrScenarioNotRepaid
+		}
+
+		date := calendar.paymentDate(n)
+		row := model.ScheduleRow{Number: n, Date: date.Format(DateFormat), Prepayment: DecimalZero}
+
+		for ; next < len(s.Events) && !s.Events[next].Date.After(date); next++ {
+			event := s.Events[next]
+			if err = t.apply(event, &row); err != nil {
+				return model.ScenarioResult{}, fmt.Errorf("line %d: %w", event.Line, err)
+			}
+			row.Events = append(row.Events, event.Type)
+		}
+
+		t.pay(&row)
+
+		result.TotalPaid = result.TotalPaid.Add(row.Payment).Add(row.Prepayment)
+		result.Schedule = append(result.Schedule, row)
+		result.LastPaymentDate = row.Date
+	}
+
+	if next < len(s.Events) {
+		return model.ScenarioResult{}, fmt.Errorf("line %d: event on %s is after the loan is repaid on %s",
+			s.Events[next].Line, s.Events[next].Date.Format(DateFormat), result.LastPaymentDate)
+	}
+
+	result.Payments = len(result.Schedule)
+	result.Overpayment = result.TotalPaid.Sub(result.LoanSum)
+
+	return result, nil
+}
+
+// timeline is the state of a loan replayed payment by payment
+type timeline struct {
+	coefficients *coefficientTable
+	frequency    paymentFrequency
+	rate         decimal.Decimal
+	periodRate   decimal.Decimal
+	payment      decimal.Decimal
+	balance      decimal.Decimal
+	// scheduled payments left, holiday months included
+	remaining int
+
+	// payment holiday in progress: months left and the frozen balance
+	holidayLeft int
+	frozen      decimal.Decimal
+	// amount frozen by holidays and the number of payments it is spread over
+	deferred         decimal.Decimal
+	deferredPayments int
+}
+
+// apply changes the loan state by the event
+func (t *timeline) apply(event scenario.Event, row *model.ScheduleRow) error {
+	switch event.Type {
+	case scenario.EventRateChange:
+		t.setRate(event.Rate)
+		return t.reschedule()
+
+	case scenario.EventRefinance:
+		t.setRate(event.Rate)
+		if event.Months > 0 {
+			t.remaining = event.Months
+		}
+		return t.reschedule()
+
+	case scenario.EventPrepayment:
+		amount := decimal.Min(event.Amount, t.balance.Add(t.deferred))
+		row.Prepayment = row.Prepayment.Add(amount)
+
+		fromBalance := decimal.Min(amount, t.balance)
+		t.balance = t.balance.Sub(fromBalance)
+		t.deferred = t.deferred.Sub(amount.Sub(fromBalance))
+
+		if event.Reduce == scenario.ReducePayment {
+			return t.reschedule()
+		}
+		t.remaining = t.periodsLeft()
+
+	case scenario.EventHoliday:
+		if event.Months > MaxHolidayMonths {
+			return model.ErrHolidayTooLong
+		}
+		if t.holidayLeft > 0 || !t.balance.IsPositive() {
+			return model.ErrHolidayInvalid
+		}
+
+		t.holidayLeft = event.Months
+		t.frozen = t.balance
+		t.deferredPayments += event.Months
+	}
+
+	return nil
+}
+
+func (t *timeline) setRate(rate decimal.Decimal) {
+	t.rate = rate
+	t.periodRate = t.frequency.periodRate(rate)
+}
+
+// reschedule recalculates the annuity payment for the balance and the remaining term
+func (t *timeline) reschedule() error {
+	if !t.balance.IsPositive() || t.remaining <= 0 {
+		return nil
+	}
+
+	coefficient, err := t.coefficients.coefficient(t.periodRate, t.remaining, nil)
+	if err != nil {
+		return err
+	}
+	t.payment = annuityPayment(t.balance, t.periodRate, coefficient, false, false, nil)
+
+	return nil
+}
+
+// periodsLeft counts the payments repaying the balance at the current payment
+func (t *timeline) periodsLeft() int {
+	balance := t.balance
+	periods := 0
+	for balance.IsPositive() && periods < maxScheduleRows {
+		balance = balance.Sub(t.payment.Sub(balance.Mul(t.periodRate).Round(2)))
+		periods++
+	}
+
+	return periods
+}
+
+// pay makes the scheduled payment. During a holiday the schedule advances as if
+// the payment was made, while its principal and the interest on the frozen
+// balance are deferred until the balance is repaid, as in calculateHoliday.
+func (t *timeline) pay(row *model.ScheduleRow) {
+	row.Rate = t.rate
+	row.Payment, row.Interest, row.Principal = DecimalZero, DecimalZero, DecimalZero
+
+	switch {
+	case t.balance.IsPositive():
+		interest := t.balance.Mul(t.periodRate).Round(2)
+		principal := t.payment.Sub(interest)
+		if t.remaining <= 1 || principal.GreaterThan(t.balance) {
+			principal = t.balance
+		}
+		t.balance = t.balance.Sub(principal)
+		t.remaining--
+
+		if t.holidayLeft > 0 {
+			t.holidayLeft--
+			t.deferred = t.deferred.Add(principal).Add(t.frozen.Mul(t.periodRate).Round(2))
+			break
+		}
+
+		row.Interest = interest
+		row.Principal = principal
+		row.Payment = interest.Add(principal)
+
+	case t.deferred.IsPositive():
+		installment := t.deferred
+		if t.deferredPayments > 1 {
+			installment = t.deferred.Div(decimal.NewFromInt(int64(t.deferredPayments))).Round(2)
+			t.deferredPayments--
+		}
+		t.deferred = t.deferred.Sub(installment)
+
+		row.Principal = installment
+		row.Payment = installment
+	}
+
+	row.Balance = t.balance
+	row.Deferred = t.deferred
+}
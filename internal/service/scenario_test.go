@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+	"github.com/velvetriddles/mortgage-calc/internal/scenario"
+)
+
+func scenarioLoan() scenario.Loan {
+	return scenario.Loan{
+		ObjectCost:     decimal.NewFromInt(5000000),
+		InitialPayment: decimal.NewFromInt(1000000),
+		Months:         240,
+		Program:        "salary",
+		StartDate:      time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// TestEvaluate_MatchesCalculate checks that the replayed schedule ends where the
+// calculator says it does, with and without a payment holiday
+func TestEvaluate_MatchesCalculate(t *testing.T) {
+	calculator := NewMortCalculator()
+	loan := scenarioLoan()
+	contract := model.NewDate(loan.StartDate)
+
+	request := model.ExecuteRequest{
+		ObjectCost:     loan.ObjectCost,
+		InitialPayment: loan.InitialPayment,
+		Months:         loan.Months,
+		Program:        model.ProgramRequest{Code: "salary"},
+		ContractDate:   &contract,
+	}
+
+	tests := []struct {
+		name    string
+		events  []scenario.Event
+		holiday *model.PaymentHoliday
+	}{
+		{
+			name: "No events",
+		},
+		{
+			name: "Holiday from the 4th payment",
+			events: []scenario.Event{
+				{Date: time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), Type: scenario.EventHoliday, Months: 3},
+			},
+			holiday: &model.PaymentHoliday{StartMonth: 4, Months: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculator.Evaluate(scenario.Scenario{Version: scenario.Version, Loan: loan, Events: tt.events})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			request.Holiday = tt.holiday
+			agg, err := calculator.Calculate(request, loan.StartDate)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.LastPaymentDate != agg.LastPaymentDate {
+				t.Errorf("Expected last payment on %s, got %s", agg.LastPaymentDate, result.LastPaymentDate)
+			}
+			if !result.MonthlyPayment.Equal(agg.MonthlyPayment) || !result.Schedule[0].Payment.Equal(agg.MonthlyPayment) {
+				t.Errorf("Expected payment %s, got %s", agg.MonthlyPayment, result.Schedule[0].Payment)
+			}
+
+			last := result.Schedule[len(result.Schedule)-1]
+			if !last.Balance.IsZero() || !last.Deferred.IsZero() {
+				t.Errorf("Expected the loan to be repaid, got %+v", last)
+			}
+
+			// The payment is rounded to rubles and the last one settles the residue,
+			// so totals agree within a ruble per payment
+			if result.Overpayment.Sub(agg.Overpayment).Abs().GreaterThan(decimal.NewFromInt(int64(loan.Months))) {
+				t.Errorf("Expected overpayment of about %s, got %s", agg.Overpayment, result.Overpayment)
+			}
+		})
+	}
+}
+
+func TestEvaluate_Events(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	base, err := calculator.Evaluate(scenario.Scenario{Version: scenario.Version, Loan: scenarioLoan()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	prepayment := func(reduce string) []scenario.Event {
+		return []scenario.Event{{
+			Date:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			Type:   scenario.EventPrepayment,
+			Amount: decimal.NewFromInt(1000000),
+			Reduce: reduce,
+		}}
+	}
+
+	term, err := calculator.Evaluate(scenario.Scenario{Loan: scenarioLoan(), Events: prepayment(scenario.ReduceTerm)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if term.Payments >= base.Payments || !term.Schedule[20].Payment.Equal(base.MonthlyPayment) {
+		t.Errorf("Expected a shorter term with the same payment, got %d payments of %s", term.Payments, term.Schedule[20].Payment)
+	}
+
+	payment, err := calculator.Evaluate(scenario.Scenario{Loan: scenarioLoan(), Events: prepayment(scenario.ReducePayment)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if payment.Payments != base.Payments || !payment.Schedule[20].Payment.LessThan(base.MonthlyPayment) {
+		t.Errorf("Expected the same term with a lower payment, got %d payments of %s", payment.Payments, payment.Schedule[20].Payment)
+	}
+	if !term.Overpayment.LessThan(payment.Overpayment) {
+		t.Errorf("Expected reducing the term to save more: %s vs %s", term.Overpayment, payment.Overpayment)
+	}
+
+	refinanced, err := calculator.Evaluate(scenario.Scenario{Loan: scenarioLoan(), Events: []scenario.Event{{
+		Date:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		Type:   scenario.EventRefinance,
+		Rate:   decimal.NewFromInt(6),
+		Months: 60,
+	}}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The 12th payment on 2025-03-01 is the first one under the new terms
+	if refinanced.Payments != 11+60 || !refinanced.Schedule[11].Rate.Equal(decimal.NewFromInt(6)) {
+		t.Errorf("Expected 71 payments at 6%% from the 12th, got %d at %s", refinanced.Payments, refinanced.Schedule[11].Rate)
+	}
+}
+
+func TestEvaluate_Errors(t *testing.T) {
+	calculator := NewMortCalculator()
+
+	loan := scenarioLoan()
+	loan.Program = "unknown"
+	if _, err := calculator.Evaluate(scenario.Scenario{Loan: loan}); !errors.Is(err, ErrUnknownProgram) {
+		t.Errorf("Expected error %v, got %v", ErrUnknownProgram, err)
+	}
+
+	_, err := calculator.Evaluate(scenario.Scenario{Loan: scenarioLoan(), Events: []scenario.Event{
+		{Line: 12, Date: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Type: scenario.EventHoliday, Months: 7},
+	}})
+	if !errors.Is(err, model.ErrHolidayTooLong) || !strings.HasPrefix(err.Error(), "line 12: ") {
+		t.Errorf("Expected %v at line 12, got %v", model.ErrHolidayTooLong, err)
+	}
+
+	_, err = calculator.Evaluate(scenario.Scenario{Loan: scenarioLoan(), Events: []scenario.Event{
+		{Line: 9, Date: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), Type: scenario.EventRateChange, Rate: decimal.NewFromInt(5)},
+	}})
+	if err == nil || !strings.HasPrefix(err.Error(), "line 9: ") {
+		t.Errorf("Expected an error for the event after repayment at line 9, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+// Package storage persists service state on the local disk.
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+// CatalogFile keeps the program catalog in a JSON file
+type CatalogFile struct {
+	path string
+}
+
+func NewCatalogFile(path string) *CatalogFile {
+	return &CatalogFile{path: path}
+}
+
+// Load reads the saved catalog, a missing file is an empty catalog of version 0
+func (f *CatalogFile) Load() (model.Catalog, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return model.Catalog{}, nil
+	}
+	if err != nil {
+		return model.Catalog{}, fmt.Errorf("error reading catalog file: %w", err)
+	}
+
+	var catalog model.Catalog
+	if err = json.Unmarshal(data, &catalog); err != nil {
+		return model.Catalog{}, fmt.Errorf("error parsing catalog file %s: %w", f.path, err)
+	}
+
+	return catalog, nil
+}
+
+// Save replaces the file atomically: the catalog is written to a temporary file
+// in the same directory and renamed over the previous one, so a crash never
+// leaves a partially written catalog
+func (f *CatalogFile) Save(catalog model.Catalog) error {
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(f.path)
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/velvetriddles/mortgage-calc/internal/model"
+)
+
+func TestCatalogFile(t *testing.T) {
+	file := NewCatalogFile(filepath.Join(t.TempDir(), "data", "programs.json"))
+
+	empty, err := file.Load()
+	if err != nil || empty.Version != 0 {
+		t.Fatalf("Expected an empty catalog for a missing file, got %+v, %v", empty, err)
+	}
+
+	catalog := model.Catalog{
+		Version:   3,
+		UpdatedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Programs: []model.ProgramDefinition{{
+			Code:   "base",
+			Name:   "Base program",
+			Active: true,
+			Tiers:  []model.RateTier{{MinInitialPayment: decimal.NewFromInt(20), Rate: decimal.NewFromInt(10)}},
+		}},
+	}
+	if err = file.Save(catalog); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	loaded, err := file.Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded.Version != 3 || !loaded.UpdatedAt.Equal(catalog.UpdatedAt) || len(loaded.Programs) != 1 ||
+		!loaded.Programs[0].Tiers[0].Rate.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("Expected the saved catalog, got %+v", loaded)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(file.path))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+}
+
+func TestCatalogFile_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "programs.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCatalogFile(path).Load(); err == nil {
+		t.Error("Expected an error for a malformed file")
+	}
+}
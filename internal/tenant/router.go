@@ -0,0 +1,171 @@
+// Package tenant routes the requests of partner sites to the handlers of
+// their tenant, so that one server runs the calculator for several partners
+// with their own program catalogs and caches.
+//
+// A request belongs to the tenant of its X-API-Key header, or else to the
+// tenant of its Host. Tenants with API keys require the key, their Host alone
+// is rejected, as is an unknown API key. Requests matching no tenant are
+// served by the default handler.
+package tenant
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// APIKeyHeader carries the API key of a tenant
+	APIKeyHeader = "X-API-Key"
+	// Header names the tenant that served the request in the response
+	Header = "X-Tenant"
+)
+
+// ErrInvalidTenant occurs for tenants that cannot be routed to
+var ErrInvalidTenant = errors.New("invalid tenant")
+
+// Tenant is a partner site served by its own handler
+type Tenant struct {
+	Code string
+	// Hosts are the host names of the partner site, without the port
+	Hosts []string
+	// APIKeys identify the partner in server-to-server requests. When set,
+	// requests for the Hosts must carry one of them too.
+	APIKeys []string
+	Handler http.Handler
+}
+
+// routes are the tenants in effect indexed by host and API key
+type routes struct {
+	fallback http.Handler
+	hosts    map[string]*Tenant
+	apiKeys  map[string]*Tenant
+}
+
+// Router serves every request with the handler of its tenant,
+// the tenants can be replaced while serving
+type Router struct {
+	routes atomic.Pointer[routes]
+}
+
+// NewRouter creates a router serving the requests of no tenant with fallback
+func NewRouter(fallback http.Handler, tenants []Tenant) (*Router, error) {
+	r := &Router{}
+	if err := r.Set(fallback, tenants); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Validate checks that every tenant can be told apart by its hosts and API keys
+func Validate(tenants []Tenant) error {
+	_, err := index(nil, tenants)
+	return err
+}
+
+// Set replaces the tenants for the next requests
+func (r *Router) Set(fallback http.Handler, tenants []Tenant) error {
+	next, err := index(fallback, tenants)
+	if err != nil {
+		return err
+	}
+
+	r.routes.Store(next)
+
+	return nil
+}
+
+// index builds the routes of the tenants
+func index(fallback http.Handler, tenants []Tenant) (*routes, error) {
+	next := &routes{
+		fallback: fallback,
+		hosts:    make(map[string]*Tenant),
+		apiKeys:  make(map[string]*Tenant),
+	}
+
+	codes := make(map[string]bool, len(tenants))
+	for i := range tenants {
+		t := &tenants[i]
+		if t.Code == "" {
+			return nil, fmt.Errorf("%w: code is required", ErrInvalidTenant)
+		}
+		if codes[t.Code] {
+			return nil, fmt.Errorf("%w: duplicate code %s", ErrInvalidTenant, t.Code)
+		}
+		codes[t.Code] = true
+
+		if len(t.Hosts) == 0 && len(t.APIKeys) == 0 {
+			return nil, fmt.Errorf("%w: %s: a host or an API key is required", ErrInvalidTenant, t.Code)
+		}
+		for _, host := range t.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := next.hosts[host]; ok {
+				return nil, fmt.Errorf("%w: %s: host %s belongs to %s", ErrInvalidTenant, t.Code, host, other.Code)
+			}
+			next.hosts[host] = t
+		}
+		for _, key := range t.APIKeys {
+			if _, ok := next.apiKeys[key]; ok {
+				// The key itself is a secret and is not reported
+				return nil, fmt.Errorf("%w: %s: duplicate API key", ErrInvalidTenant, t.Code)
+			}
+			next.apiKeys[key] = t
+		}
+	}
+
+	return next, nil
+}
+
+// ServeHTTP serves the request with the handler of its tenant
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	current := r.routes.Load()
+
+	t, err := current.resolve(req)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		if err = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); err != nil {
+			log.Printf("Error encoding response: %v", err)
+		}
+		return
+	}
+
+	if t == nil {
+		current.fallback.ServeHTTP(w, req)
+		return
+	}
+
+	w.Header().Set(Header, t.Code)
+	t.Handler.ServeHTTP(w, req)
+}
+
+// resolve returns the tenant of the request, nil for requests of no tenant
+func (r *routes) resolve(req *http.Request) (*Tenant, error) {
+	if key := req.Header.Get(APIKeyHeader); key != "" {
+		t, ok := r.apiKeys[key]
+		if !ok {
+			return nil, errors.New("unknown API key")
+		}
+		return t, nil
+	}
+
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	// The Host header is set by the client, so it cannot stand in for the
+	// API key of a tenant that has one
+	t := r.hosts[strings.ToLower(host)]
+	if t != nil && len(t.APIKeys) > 0 {
+		return nil, errors.New("API key required")
+	}
+
+	return t, nil
+}
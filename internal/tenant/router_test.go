@@ -0,0 +1,115 @@
+package tenant
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// named answers with its name, to tell which handler served the request
+func named(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(name))
+	})
+}
+
+func TestRouter(t *testing.T) {
+	router, err := NewRouter(named("default"), []Tenant{
+		{Code: "alfa", Hosts: []string{"calc.alfa.example"}, APIKeys: []string{"alfa-key"}, Handler: named("alfa")},
+		{Code: "beta", APIKeys: []string{"beta-key"}, Handler: named("beta")},
+		{Code: "gamma", Hosts: []string{"calc.gamma.example"}, Handler: named("gamma")},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		host     string
+		apiKey   string
+		status   int
+		expected string
+		tenant   string
+	}{
+		{name: "host", host: "calc.gamma.example", status: http.StatusOK, expected: "gamma", tenant: "gamma"},
+		{name: "host with port", host: "CALC.gamma.example:8080", status: http.StatusOK, expected: "gamma", tenant: "gamma"},
+		{name: "host with API key", host: "calc.alfa.example", apiKey: "alfa-key", status: http.StatusOK, expected: "alfa", tenant: "alfa"},
+		{name: "host without the API key", host: "calc.alfa.example", status: http.StatusUnauthorized,
+			expected: "{\"error\":\"API key required\"}\n"},
+		{name: "API key", host: "localhost", apiKey: "beta-key", status: http.StatusOK, expected: "beta", tenant: "beta"},
+		{name: "API key over host", host: "calc.alfa.example", apiKey: "beta-key", status: http.StatusOK, expected: "beta", tenant: "beta"},
+		{name: "no tenant", host: "localhost:8080", status: http.StatusOK, expected: "default"},
+		{name: "unknown API key", host: "calc.alfa.example", apiKey: "stolen", status: http.StatusUnauthorized,
+			expected: "{\"error\":\"unknown API key\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/branding", nil)
+			req.Host = tt.host
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status || rr.Body.String() != tt.expected {
+				t.Errorf("Expected %d %q, got %d %q", tt.status, tt.expected, rr.Code, rr.Body.String())
+			}
+			if tenant := rr.Header().Get(Header); tenant != tt.tenant {
+				t.Errorf("Expected header %s: %q, got %q", Header, tt.tenant, tenant)
+			}
+		})
+	}
+}
+
+// TestRouter_SpoofedHost checks that a tenant with API keys cannot be reached
+// by sending its Host header, so another client cannot read its cache
+func TestRouter_SpoofedHost(t *testing.T) {
+	router, _ := NewRouter(named("default"), []Tenant{
+		{Code: "alfa", Hosts: []string{"calc.alfa.example"}, APIKeys: []string{"alfa-key"}, Handler: named("alfa cache")},
+		{Code: "beta", Hosts: []string{"calc.beta.example"}, APIKeys: []string{"beta-key"}, Handler: named("beta cache")},
+	})
+
+	// A client of beta sends the Host of alfa, with and without its own key
+	for _, apiKey := range []string{"", "beta-key"} {
+		req := httptest.NewRequest("GET", "/cache", nil)
+		req.Host = "calc.alfa.example"
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Body.String() == "alfa cache" {
+			t.Errorf("Expected the cache of alfa to stay private with API key %q, got %d %q", apiKey, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestRouter_Set(t *testing.T) {
+	router, _ := NewRouter(named("default"), []Tenant{{Code: "alfa", Hosts: []string{"alfa.example"}, Handler: named("alfa")}})
+
+	invalid := [][]Tenant{
+		{{Hosts: []string{"a.example"}}},
+		{{Code: "a", Hosts: []string{"a.example"}}, {Code: "a", Hosts: []string{"b.example"}}},
+		{{Code: "a"}},
+		{{Code: "a", Hosts: []string{"same.example"}}, {Code: "b", Hosts: []string{"SAME.example"}}},
+		{{Code: "a", APIKeys: []string{"key"}}, {Code: "b", APIKeys: []string{"key"}}},
+	}
+	for _, tenants := range invalid {
+		if err := router.Set(named("default"), tenants); !errors.Is(err, ErrInvalidTenant) {
+			t.Errorf("Expected error %v for %+v, got %v", ErrInvalidTenant, tenants, err)
+		}
+	}
+
+	// Rejected tenants leave the previous ones in effect
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "alfa.example"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Body.String() != "alfa" {
+		t.Errorf("Expected the previous tenants to stay, got %q", rr.Body.String())
+	}
+}